@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/client/registry"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+)
+
+// Session is the state of a connected session, as returned by the admin API.
+type Session struct {
+	ID              uuid.UUID `json:"id"`
+	Tenant          string    `json:"tenant"`
+	Proxy           string    `json:"proxy"`
+	XUID            string    `json:"xuid,omitempty"`
+	DisplayName     string    `json:"display_name,omitempty"`
+	RemoteAddr      string    `json:"remote_addr"`
+	ConnectedAt     time.Time `json:"connected_at"`
+	Uptime          string    `json:"uptime"`
+	PacketsReceived uint64    `json:"packets_received"`
+	BytesReceived   uint64    `json:"bytes_received"`
+}
+
+// SessionDetails is the detailed state of a connected session, as returned by the admin API.
+type SessionDetails struct {
+	Session
+	Authenticated     bool      `json:"authenticated"`
+	ProtocolVersion   uint32    `json:"protocol_version,omitempty"`
+	MinecraftProtocol int32     `json:"minecraft_protocol,omitempty"`
+	PlayerUUID        string    `json:"player_uuid,omitempty"`
+	DeviceOS          int       `json:"device_os,omitempty"`
+	ClientVersion     string    `json:"client_version,omitempty"`
+	TokenExpiry       time.Time `json:"token_expiry,omitzero"`
+	DeferredPackets   int       `json:"deferred_packets"`
+	// Handlers holds the types of the handlers of the session, in the order they are called.
+	Handlers []string `json:"handlers"`
+}
+
+// DisconnectRequest is the body of a request to disconnect a session.
+type DisconnectRequest struct {
+	// Message is the message sent to the proxy, describing why the session was disconnected.
+	Message string `json:"message"`
+}
+
+// RevocationRequest is the body of a request to revoke tokens.
+type RevocationRequest struct {
+	// Kind is the kind of revocation, which is one of "token", "proxy" or "tenant".
+	Kind string `json:"kind"`
+	// Value is the token ID, proxy ID or tenant ID that is revoked.
+	Value string `json:"value"`
+	// Reason is the reason the tokens are revoked, which is sent to the proxies disconnected.
+	Reason string `json:"reason"`
+}
+
+// Admin serves the admin API, which lists, inspects and disconnects the sessions currently connected, and revokes
+// tokens. Requests require a token with the admin scope.
+type Admin struct {
+	clients     *registry.Registry
+	revocations *jwt.RevocationStore
+	auth        authenticator
+}
+
+// NewAdmin returns an Admin serving the clients in the registry passed. Tokens are revoked in, and rejected if they
+// were revoked in, the revocation store passed.
+func NewAdmin(clients *registry.Registry, revocations *jwt.RevocationStore) *Admin {
+	return &Admin{clients: clients, revocations: revocations, auth: authenticator{revocations: revocations}}
+}
+
+// Register registers the endpoints of the admin API with the mux passed.
+func (a *Admin) Register(mux *http.ServeMux) {
+	mux.Handle("GET /admin/sessions", a.auth.require(ScopeAdmin, a.list))
+	mux.Handle("GET /admin/sessions/{id}", a.auth.require(ScopeAdmin, a.inspect))
+	mux.Handle("POST /admin/sessions/{id}/disconnect", a.auth.require(ScopeAdmin, a.disconnect))
+	mux.Handle("POST /admin/revocations", a.auth.require(ScopeAdmin, a.revoke))
+}
+
+// list lists the sessions accessible with the token, optionally filtered by the tenant, player and addr query
+// parameters.
+func (a *Admin) list(w http.ResponseWriter, r *http.Request, access Access) {
+	q := r.URL.Query()
+	clients := a.clients.Clients()
+	if player := q.Get("player"); player != "" {
+		clients = a.clients.ByPlayer(player)
+	} else if addr := q.Get("addr"); addr != "" {
+		clients = a.clients.ByAddr(addr)
+	} else if q.Has("tenant") {
+		clients = a.clients.ByTenant(q.Get("tenant"))
+	}
+
+	sessions := make([]Session, 0, len(clients))
+	for _, c := range clients {
+		if !access.Allows(c.Tenant()) || (q.Has("tenant") && c.Tenant() != q.Get("tenant")) {
+			continue
+		}
+		sessions = append(sessions, session(c))
+	}
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// inspect returns the detailed state of a single session.
+func (a *Admin) inspect(w http.ResponseWriter, r *http.Request, access Access) {
+	c, ok := a.lookup(w, r, access)
+	if !ok {
+		return
+	}
+
+	details := SessionDetails{
+		Session:         session(c),
+		Authenticated:   c.Authenticated(),
+		TokenExpiry:     c.TokenExpiry(),
+		DeferredPackets: c.DeferredPackets(),
+	}
+	if proto, ok := c.Protocol(); ok {
+		details.ProtocolVersion = proto.Version
+		details.MinecraftProtocol = proto.MinecraftProtocol
+	}
+	if id, ok := c.Identity(); ok {
+		details.PlayerUUID = id.UUID
+		details.DeviceOS = int(id.DeviceOS)
+		details.ClientVersion = id.ClientVersion
+	}
+	for _, h := range c.OrderedHandlers() {
+		details.Handlers = append(details.Handlers, fmt.Sprintf("%T", h))
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+// disconnect forcibly disconnects a session, sending the message in the request body to the proxy.
+func (a *Admin) disconnect(w http.ResponseWriter, r *http.Request, access Access) {
+	c, ok := a.lookup(w, r, access)
+	if !ok {
+		return
+	}
+
+	var req DisconnectRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		req.Message = "disconnected by an administrator"
+	}
+
+	_ = c.Disconnect(cloudpacket.DisconnectReasonKicked, req.Message)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revoke revokes the tokens described in the request body. Sessions authenticated with any of the tokens are
+// disconnected immediately. Tokens without the global scope may only revoke their own tenant, as token and proxy
+// IDs are not guaranteed to be unique across tenants.
+func (a *Admin) revoke(w http.ResponseWriter, r *http.Request, access Access) {
+	var req RevocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if !access.Global && (req.Kind != jwt.RevokeTenant || req.Value != access.Claims.Tenant) {
+		writeError(w, http.StatusForbidden, "token may only revoke its own tenant")
+		return
+	}
+
+	rev := jwt.Revocation{
+		Kind:   req.Kind,
+		Value:  req.Value,
+		Reason: strings.TrimSpace(req.Reason),
+		Time:   time.Now(),
+	}
+	if err := rev.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The revocation is applied even if it could not be persisted, so the sessions using it are still closed and
+	// it is kept until the server restarts. The error is reported so that the revocation is added to the file.
+	if err := a.revocations.Revoke(rev); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, rev)
+}
+
+// lookup returns the client of the session in the path of the request. If the session does not exist or may
+// not be accessed with the token, an error is written and false is returned.
+func (a *Admin) lookup(w http.ResponseWriter, r *http.Request, access Access) (*client.Client, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid session ID: %v", err))
+		return nil, false
+	}
+	// Sessions of other tenants are reported as not found, so that their existence is not revealed.
+	c, ok := a.clients.Client(id)
+	if !ok || !access.Allows(c.Tenant()) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return nil, false
+	}
+	return c, true
+}
+
+// session returns the state of the session of the client passed.
+func session(c *client.Client) Session {
+	s := Session{
+		ID:              c.SessionID(),
+		Tenant:          c.Tenant(),
+		RemoteAddr:      c.Addr().String(),
+		ConnectedAt:     c.ConnectedAt(),
+		Uptime:          time.Since(c.ConnectedAt()).Round(time.Second).String(),
+		PacketsReceived: c.PacketsReceived(),
+		BytesReceived:   c.BytesReceived(),
+	}
+	if claims := c.Claims(); claims != nil {
+		s.Proxy = claims.Proxy
+	}
+	if id, ok := c.Identity(); ok {
+		s.XUID = id.XUID
+		s.DisplayName = id.DisplayName
+	}
+	return s
+}
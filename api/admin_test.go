@@ -0,0 +1,136 @@
+package api_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oomph-ac/ocloud/api"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/client/registry"
+	"github.com/oomph-ac/ocloud/internal/pipe"
+	"github.com/rs/zerolog"
+)
+
+// connect adds an authenticated client of the tenant and proxy passed to the registry passed.
+func connect(t *testing.T, clients *registry.Registry, revocations *jwt.RevocationStore, tenant, proxy string) *client.Client {
+	t.Helper()
+	stream, proxyConn := pipe.New()
+	go func() {
+		_, _ = io.Copy(io.Discard, proxyConn)
+	}()
+
+	c := client.New(stream, stream.RemoteAddr(), zerolog.Nop(), client.DefaultConfig())
+	t.Cleanup(func() {
+		_ = c.Close(nil)
+		_ = proxyConn.Close()
+	})
+	c.SetClaims(&jwt.Claims{Tenant: tenant, Proxy: proxy})
+	c.SetAuthenticated(true)
+	c.RegisterHandler(handler.NewRevocationWatcher(c, revocations))
+	clients.Add(c)
+	return c
+}
+
+// post serves a POST request with the target, token and body passed, returning the response recorded.
+func post(mux *http.ServeMux, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// closed returns true if the client passed is closed within a second.
+func closed(c *client.Client) bool {
+	select {
+	case <-c.Done():
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	revocations := configure(t)
+	clients := registry.New()
+	a := connect(t, clients, revocations, "a", "proxy-1")
+	b := connect(t, clients, revocations, "b", "proxy-1")
+
+	mux := http.NewServeMux()
+	api.NewAdmin(clients, revocations).Register(mux)
+	tok := token(t, "a", api.ScopeAdmin)
+
+	var sessions []api.Session
+	decode(t, request(mux, "GET", "/admin/sessions", tok), http.StatusOK, &sessions)
+	if len(sessions) != 1 || sessions[0].ID != a.SessionID() || sessions[0].Proxy != "proxy-1" {
+		t.Errorf("expected only sessions of the tenant to be listed, got %+v", sessions)
+	}
+	decode(t, request(mux, "GET", "/admin/sessions", token(t, "", api.ScopeAdmin, api.ScopeGlobal)), http.StatusOK, &sessions)
+	if len(sessions) != 2 {
+		t.Errorf("expected global token to list sessions of all tenants, got %+v", sessions)
+	}
+	decode(t, request(mux, "GET", "/admin/sessions?tenant=b", token(t, "", api.ScopeAdmin, api.ScopeGlobal)), http.StatusOK, &sessions)
+	if len(sessions) != 1 || sessions[0].ID != b.SessionID() {
+		t.Errorf("expected only sessions of the tenant queried to be listed, got %+v", sessions)
+	}
+	if w := request(mux, "GET", "/admin/sessions", token(t, "a", api.ScopeReplay)); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected request without admin scope to be rejected, got %d", w.Code)
+	}
+
+	var details api.SessionDetails
+	decode(t, request(mux, "GET", "/admin/sessions/"+a.SessionID().String(), tok), http.StatusOK, &details)
+	if !details.Authenticated || details.Tenant != "a" {
+		t.Errorf("unexpected details %+v", details)
+	}
+	decode(t, request(mux, "GET", "/admin/sessions/"+b.SessionID().String(), tok), http.StatusNotFound, nil)
+
+	decode(t, post(mux, "/admin/sessions/"+b.SessionID().String()+"/disconnect", tok, ""), http.StatusNotFound, nil)
+	decode(t, post(mux, "/admin/sessions/"+a.SessionID().String()+"/disconnect", tok, `{"message":"bye"}`), http.StatusNoContent, nil)
+	if !closed(a) {
+		t.Error("expected session to be disconnected")
+	}
+}
+
+func TestAdminRevoke(t *testing.T) {
+	revocations := configure(t)
+	clients := registry.New()
+	a := connect(t, clients, revocations, "a", "proxy-1")
+	b := connect(t, clients, revocations, "b", "proxy-1")
+	other := connect(t, clients, revocations, "b", "proxy-2")
+
+	mux := http.NewServeMux()
+	api.NewAdmin(clients, revocations).Register(mux)
+	tok := token(t, "a", api.ScopeAdmin)
+	global := token(t, "", api.ScopeAdmin, api.ScopeGlobal)
+
+	decode(t, post(mux, "/admin/revocations", tok, `{"kind":"tenant","value":"b"}`), http.StatusForbidden, nil)
+	decode(t, post(mux, "/admin/revocations", tok, `{"kind":"proxy","value":"proxy-1"}`), http.StatusForbidden, nil)
+	decode(t, post(mux, "/admin/revocations", global, `{"kind":"session","value":"b"}`), http.StatusBadRequest, nil)
+	decode(t, post(mux, "/admin/revocations", global, `{"kind":"proxy"}`), http.StatusBadRequest, nil)
+	decode(t, post(mux, "/admin/revocations", global, `{`), http.StatusBadRequest, nil)
+
+	var rev jwt.Revocation
+	decode(t, post(mux, "/admin/revocations", global, `{"kind":"proxy","value":"proxy-1","reason":"leaked"}`), http.StatusCreated, &rev)
+	if rev.Kind != jwt.RevokeProxy || rev.Value != "proxy-1" || rev.Reason != "leaked" || rev.Time.IsZero() {
+		t.Errorf("unexpected revocation %+v", rev)
+	}
+	if !closed(a) || !closed(b) {
+		t.Error("expected sessions of revoked proxy to be disconnected")
+	}
+	if closed(other) {
+		t.Error("expected sessions of other proxies to stay connected")
+	}
+	if _, ok := revocations.Revoked(&jwt.Claims{Tenant: "c", Proxy: "proxy-1"}); !ok {
+		t.Error("expected revocation to be stored")
+	}
+
+	// Tokens may revoke their own tenant, which also revokes the token itself.
+	decode(t, post(mux, "/admin/revocations", tok, `{"kind":"tenant","value":"a"}`), http.StatusCreated, nil)
+	decode(t, request(mux, "GET", "/admin/sessions", tok), http.StatusUnauthorized, nil)
+}
@@ -0,0 +1,69 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/oomph-ac/ocloud/client/jwt"
+)
+
+var secret = []byte("test-secret")
+
+// configure configures token validation with the test secret and returns an empty revocation store.
+func configure(t *testing.T) *jwt.RevocationStore {
+	t.Helper()
+	jwt.Configure(jwt.DefaultConfig(jwt.SecretKey(secret)))
+	revocations, err := jwt.NewRevocationStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revocations
+}
+
+// token returns a token of the tenant passed, granted the scopes passed.
+func token(t *testing.T, tenant string, scopes ...string) string {
+	t.Helper()
+	s, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, &jwt.Claims{
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ID:        tenant + "-token",
+			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Tenant: tenant,
+		Proxy:  "panel",
+		Scopes: scopes,
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// request serves a request with the method, target and token passed, returning the response recorded.
+func request(mux *http.ServeMux, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// decode decodes the JSON body of the response passed into v, failing the test if the status is not the status
+// passed.
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	if v == nil {
+		return
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatal(err)
+	}
+}
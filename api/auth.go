@@ -0,0 +1,92 @@
+// Package api implements the HTTP APIs of the server. All endpoints are authenticated with the same tokens as
+// proxies, and are limited to the tenant of the token unless it was granted the global scope.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/tenant"
+)
+
+const (
+	// ScopeAdmin grants access to the admin API.
+	ScopeAdmin = "admin"
+	// ScopeReplay grants access to the replay API.
+	ScopeReplay = "replay"
+	// ScopeGlobal grants access to the data of all tenants, rather than only the tenant of the token.
+	ScopeGlobal = "global"
+)
+
+// Access describes what the bearer of a token may access.
+type Access struct {
+	// Claims are the claims of the token.
+	Claims *jwt.Claims
+	// Global is true if the token may access the data of all tenants.
+	Global bool
+}
+
+// Allows returns true if the data of the tenant passed may be accessed.
+func (a Access) Allows(tenant string) bool {
+	return a.Global || a.Claims.Tenant == tenant
+}
+
+// authenticator authenticates requests using the bearer token in their Authorization header.
+type authenticator struct {
+	revocations *jwt.RevocationStore
+}
+
+// require wraps the handler passed so that it is only called for requests with a valid token holding the scope
+// passed. The access granted by the token is passed to the handler.
+func (a authenticator) require(scope string, h func(w http.ResponseWriter, r *http.Request, access Access)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := a.authenticate(r, scope)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		h(w, r, access)
+	})
+}
+
+// authenticate validates the bearer token of the request passed and checks that it holds the scope passed.
+func (a authenticator) authenticate(r *http.Request, scope string) (Access, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return Access{}, fmt.Errorf("missing bearer token")
+	}
+	claims, err := jwt.Validate(token)
+	if err != nil {
+		return Access{}, fmt.Errorf("invalid token: %v", err)
+	}
+	if rev, ok := a.revocations.Revoked(claims); ok {
+		return Access{}, fmt.Errorf("token revoked (%s %s)", rev.Kind, rev.Value)
+	}
+	if !claims.HasScope(scope) {
+		return Access{}, fmt.Errorf("token lacks the %q scope", scope)
+	}
+
+	access := Access{Claims: claims, Global: claims.HasScope(ScopeGlobal)}
+	if !access.Global {
+		if err := tenant.Validate(claims.Tenant); err != nil {
+			return Access{}, fmt.Errorf("invalid token: %v", err)
+		}
+	}
+	return access, nil
+}
+
+// writeJSON writes the value passed as JSON with the status passed.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error with the status and message passed.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
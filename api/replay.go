@@ -0,0 +1,332 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/catalogue"
+	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/recording"
+)
+
+const (
+	// defaultSearchLimit is the amount of sessions returned by a search if no limit is passed.
+	defaultSearchLimit = 100
+	// maxSearchLimit is the maximum amount of sessions returned by a search.
+	maxSearchLimit = 1000
+)
+
+// Recording is a recorded session in the catalogue, as returned by the replay API.
+type Recording struct {
+	ID          uuid.UUID `json:"id"`
+	Tenant      string    `json:"tenant"`
+	Proxy       string    `json:"proxy"`
+	XUID        string    `json:"xuid,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	RemoteAddr  string    `json:"remote_addr"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time,omitzero"`
+	Packets     uint64    `json:"packets"`
+	Flags       int       `json:"flags"`
+	Size        int64     `json:"size"`
+}
+
+// RecordingDetails is the metadata of a recorded session, as returned by the replay API.
+type RecordingDetails struct {
+	Recording
+	// Metadata is the metadata stored in the recording itself.
+	Metadata recording.Metadata `json:"metadata"`
+	// ProtocolVersion is the Minecraft protocol version of the recorded packets.
+	ProtocolVersion int32 `json:"protocol_version"`
+	// Duration is the time between the start of the recording and the last packet recorded.
+	Duration string `json:"duration"`
+	// Chunks is the amount of chunks in the recording.
+	Chunks int `json:"chunks"`
+	// Finalized is false if the session is still being recorded, or the recording was interrupted.
+	Finalized bool `json:"finalized"`
+}
+
+// FlagEntry is a flag in the timeline of a recorded session, as returned by the replay API.
+type FlagEntry struct {
+	// Time is the time at which the flag occurred.
+	Time time.Time `json:"time"`
+	// Offset is the time at which the flag occurred relative to the start of the recording, in milliseconds.
+	Offset int64 `json:"offset_ms"`
+	// Tick is the tick of the player at which the flag occurred.
+	Tick       uint64  `json:"tick"`
+	Type       string  `json:"type"`
+	SubType    string  `json:"sub_type"`
+	Violations float32 `json:"violations"`
+}
+
+// Replay serves the replay API, which searches the session catalogue and serves recordings. Requests require a
+// token with the replay scope.
+type Replay struct {
+	cat  catalogue.Catalogue
+	auth authenticator
+}
+
+// NewReplay returns a Replay serving the sessions in the catalogue passed. Tokens are rejected if they were
+// revoked in the revocation store passed.
+func NewReplay(cat catalogue.Catalogue, revocations *jwt.RevocationStore) *Replay {
+	return &Replay{cat: cat, auth: authenticator{revocations: revocations}}
+}
+
+// Register registers the endpoints of the replay API with the mux passed.
+func (rp *Replay) Register(mux *http.ServeMux) {
+	mux.Handle("GET /replays", rp.auth.require(ScopeReplay, rp.search))
+	mux.Handle("GET /replays/{id}", rp.auth.require(ScopeReplay, rp.details))
+	mux.Handle("GET /replays/{id}/flags", rp.auth.require(ScopeReplay, rp.flags))
+	mux.Handle("GET /replays/{id}/recording", rp.auth.require(ScopeReplay, rp.download))
+}
+
+// search searches the catalogue for sessions matching the query parameters of the request.
+func (rp *Replay) search(w http.ResponseWriter, r *http.Request, access Access) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cat := rp.cat
+	if !access.Global {
+		if q.Tenant != "" && q.Tenant != access.Claims.Tenant {
+			writeError(w, http.StatusForbidden, "token may not access tenant "+q.Tenant)
+			return
+		}
+		cat = catalogue.ForTenant(cat, access.Claims.Tenant)
+	}
+
+	sessions, err := cat.Find(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to search catalogue: %v", err))
+		return
+	}
+	recordings := make([]Recording, len(sessions))
+	for i, s := range sessions {
+		recordings[i] = recordingOf(s)
+	}
+	writeJSON(w, http.StatusOK, recordings)
+}
+
+// details returns the metadata of a recorded session.
+func (rp *Replay) details(w http.ResponseWriter, r *http.Request, access Access) {
+	s, f, ok := rp.open(w, r, access)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	writeJSON(w, http.StatusOK, RecordingDetails{
+		Recording:       recordingOf(s),
+		Metadata:        f.Metadata(),
+		ProtocolVersion: f.Header().ProtocolVersion,
+		Duration:        f.Duration().String(),
+		Chunks:          len(f.Index()),
+		Finalized:       f.Finalized(),
+	})
+}
+
+// flags returns the timeline of flags of a recorded session, optionally filtered by the type query parameter.
+func (rp *Replay) flags(w http.ResponseWriter, r *http.Request, access Access) {
+	s, f, ok := rp.open(w, r, access)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	detection := r.URL.Query().Get("type")
+	flags := make([]FlagEntry, 0)
+	for _, flag := range f.Flags() {
+		if detection != "" && flag.Type != detection {
+			continue
+		}
+		flags = append(flags, FlagEntry{
+			Time:       s.StartTime.Add(flag.Offset),
+			Offset:     flag.Offset.Milliseconds(),
+			Tick:       flag.Tick,
+			Type:       flag.Type,
+			SubType:    flag.SubType,
+			Violations: flag.Violations,
+		})
+	}
+	writeJSON(w, http.StatusOK, flags)
+}
+
+// download serves the recording of a session, supporting range requests. If the from or to query parameters
+// are passed, either as an offset from the start of the recording (such as "90s") or as an RFC 3339 time, only
+// the chunks of the recording overlapping that time range are served.
+func (rp *Replay) download(w http.ResponseWriter, r *http.Request, access Access) {
+	s, f, ok := rp.open(w, r, access)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	q := r.URL.Query()
+	name := s.ID.String() + handler.RecordingExtension
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	if !q.Has("from") && !q.Has("to") {
+		file, err := os.Open(s.Path)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to open recording: %v", err))
+			return
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to stat recording: %v", err))
+			return
+		}
+		http.ServeContent(w, r, name, stat.ModTime(), file)
+		return
+	}
+
+	start := f.Header().StartTime
+	from, err := parseOffset(q.Get("from"), start, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	to, err := parseOffset(q.Get("to"), start, math.MaxInt64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+
+	// The slice is written to a temporary file, so that range requests for it can be served.
+	tmp, err := os.CreateTemp("", "ocloud-slice-*"+handler.RecordingExtension)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create slice: %v", err))
+		return
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := recording.Slice(tmp, f, from, to); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to slice recording: %v", err))
+		return
+	}
+	http.ServeContent(w, r, name, time.Time{}, tmp)
+}
+
+// open looks up the session in the path of the request and opens its recording. If the session does not exist,
+// may not be accessed with the token or its recording cannot be opened, an error is written and false is
+// returned.
+func (rp *Replay) open(w http.ResponseWriter, r *http.Request, access Access) (catalogue.Session, *recording.File, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid session ID: %v", err))
+		return catalogue.Session{}, nil, false
+	}
+	// Sessions of other tenants are reported as not found, so that their existence is not revealed.
+	s, ok := rp.cat.Session(id)
+	if !ok || !access.Allows(s.Tenant) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return s, nil, false
+	}
+	if _, err := os.Stat(s.Path); errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "recording not found")
+		return s, nil, false
+	}
+	f, err := recording.Open(s.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return s, nil, false
+	}
+	return s, f, true
+}
+
+// parseQuery parses the catalogue query from the query parameters of the request passed.
+func parseQuery(r *http.Request) (catalogue.Query, error) {
+	v := r.URL.Query()
+	q := catalogue.Query{
+		XUID:        v.Get("xuid"),
+		DisplayName: v.Get("name"),
+		Tenant:      v.Get("tenant"),
+		Proxy:       v.Get("proxy"),
+		RemoteAddr:  v.Get("addr"),
+		Limit:       defaultSearchLimit,
+	}
+	if player := v.Get("player"); player != "" {
+		// Players may be searched by either their XUID or gamertag. XUIDs are purely numeric, while gamertags
+		// must start with a letter.
+		if _, err := strconv.ParseUint(player, 10, 64); err == nil {
+			q.XUID = player
+		} else {
+			q.DisplayName = player
+		}
+	}
+
+	var err error
+	if s := v.Get("from"); s != "" {
+		if q.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if s := v.Get("to"); s != "" {
+		if q.To, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if s := v.Get("min_duration"); s != "" {
+		if q.MinDuration, err = time.ParseDuration(s); err != nil {
+			return q, fmt.Errorf("invalid min_duration: %v", err)
+		}
+	}
+	if s := v.Get("has_flags"); s != "" {
+		if q.HasFlags, err = strconv.ParseBool(s); err != nil {
+			return q, fmt.Errorf("invalid has_flags: %v", err)
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("invalid limit %q", s)
+		}
+		q.Limit = min(q.Limit, maxSearchLimit)
+	}
+	return q, nil
+}
+
+// parseOffset parses an offset from the start of a recording, either as a duration or as an RFC 3339 time. The
+// default passed is returned if the value is empty.
+func parseOffset(v string, start time.Time, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither a duration nor an RFC 3339 time", v)
+	}
+	return t.Sub(start), nil
+}
+
+// recordingOf returns the recorded session passed as returned by the replay API. The path of the recording is
+// left out, as it is of no use to clients.
+func recordingOf(s catalogue.Session) Recording {
+	return Recording{
+		ID:          s.ID,
+		Tenant:      s.Tenant,
+		Proxy:       s.Proxy,
+		XUID:        s.XUID,
+		DisplayName: s.DisplayName,
+		RemoteAddr:  s.RemoteAddr,
+		StartTime:   s.StartTime,
+		EndTime:     s.EndTime,
+		Packets:     s.Packets,
+		Flags:       s.Flags,
+		Size:        s.Size,
+	}
+}
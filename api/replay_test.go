@@ -0,0 +1,169 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/api"
+	"github.com/oomph-ac/ocloud/catalogue"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/recording"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// record writes a recording for the tenant passed holding a packet every second for 20 seconds and a flag at
+// 12 seconds, and puts it into the catalogue passed.
+func record(t *testing.T, cat catalogue.Catalogue, tenant string) catalogue.Session {
+	t.Helper()
+	s := catalogue.Session{
+		ID:          uuid.New(),
+		Tenant:      tenant,
+		DisplayName: "Steve",
+		StartTime:   start,
+		EndTime:     start.Add(time.Second * 20),
+		Flags:       1,
+		Path:        filepath.Join(t.TempDir(), "session.ocr"),
+	}
+	w, err := recording.Create(s.Path, recording.Header{SessionID: s.ID, StartTime: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if err := w.WritePacket(start.Add(time.Duration(i)*time.Second), &cloudpacket.Detection{Tick: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteFlag(start.Add(time.Second*12), recording.Flag{Tick: 12, Type: "Reach", SubType: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.Put(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// replay returns a mux serving the replay API over a catalogue holding one session of tenant a and one session
+// of tenant b.
+func replay(t *testing.T) (*http.ServeMux, *jwt.RevocationStore, catalogue.Session, catalogue.Session) {
+	t.Helper()
+	revocations := configure(t)
+	cat, err := catalogue.OpenFile(filepath.Join(t.TempDir(), "sessions.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cat.Close()
+	})
+	a, b := record(t, cat, "a"), record(t, cat, "b")
+
+	mux := http.NewServeMux()
+	api.NewReplay(cat, revocations).Register(mux)
+	return mux, revocations, a, b
+}
+
+func TestReplayAuthentication(t *testing.T) {
+	mux, revocations, _, _ := replay(t)
+
+	if w := request(mux, "GET", "/replays", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected request without token to be rejected, got %d", w.Code)
+	}
+	if w := request(mux, "GET", "/replays", "invalid"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected request with invalid token to be rejected, got %d", w.Code)
+	}
+	if w := request(mux, "GET", "/replays", token(t, "a", api.ScopeAdmin)); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected request without replay scope to be rejected, got %d", w.Code)
+	}
+
+	if err := revocations.Revoke(jwt.Revocation{Kind: "tenant", Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := request(mux, "GET", "/replays", token(t, "a", api.ScopeReplay)); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected request with revoked token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestReplaySearch(t *testing.T) {
+	mux, _, a, b := replay(t)
+
+	var recordings []api.Recording
+	decode(t, request(mux, "GET", "/replays?player=steve", token(t, "a", api.ScopeReplay)), http.StatusOK, &recordings)
+	if len(recordings) != 1 || recordings[0].ID != a.ID {
+		t.Errorf("expected only sessions of the tenant to be found, got %+v", recordings)
+	}
+	decode(t, request(mux, "GET", "/replays?tenant=b", token(t, "a", api.ScopeReplay)), http.StatusForbidden, nil)
+
+	decode(t, request(mux, "GET", "/replays?has_flags=true", token(t, "", api.ScopeReplay, api.ScopeGlobal)), http.StatusOK, &recordings)
+	if len(recordings) != 2 {
+		t.Errorf("expected global token to find sessions of all tenants, got %+v", recordings)
+	}
+	decode(t, request(mux, "GET", "/replays?tenant=b", token(t, "", api.ScopeReplay, api.ScopeGlobal)), http.StatusOK, &recordings)
+	if len(recordings) != 1 || recordings[0].ID != b.ID {
+		t.Errorf("expected global token to filter by tenant, got %+v", recordings)
+	}
+	decode(t, request(mux, "GET", "/replays?limit=0", token(t, "a", api.ScopeReplay)), http.StatusBadRequest, nil)
+}
+
+func TestReplayDetails(t *testing.T) {
+	mux, _, a, b := replay(t)
+	tok := token(t, "a", api.ScopeReplay)
+
+	var details api.RecordingDetails
+	decode(t, request(mux, "GET", "/replays/"+a.ID.String(), tok), http.StatusOK, &details)
+	if details.ID != a.ID || !details.Finalized || details.Chunks != 4 || details.Duration != "19s" {
+		t.Errorf("unexpected details %+v", details)
+	}
+	decode(t, request(mux, "GET", "/replays/"+b.ID.String(), tok), http.StatusNotFound, nil)
+	decode(t, request(mux, "GET", "/replays/"+uuid.NewString(), tok), http.StatusNotFound, nil)
+	decode(t, request(mux, "GET", "/replays/invalid", tok), http.StatusBadRequest, nil)
+
+	var flags []api.FlagEntry
+	decode(t, request(mux, "GET", "/replays/"+a.ID.String()+"/flags", tok), http.StatusOK, &flags)
+	if len(flags) != 1 || flags[0].Tick != 12 || flags[0].Offset != 12000 || !flags[0].Time.Equal(start.Add(time.Second*12)) {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+	decode(t, request(mux, "GET", "/replays/"+a.ID.String()+"/flags?type=Timer", tok), http.StatusOK, &flags)
+	if len(flags) != 0 {
+		t.Errorf("expected flags to be filtered by type, got %+v", flags)
+	}
+}
+
+func TestReplayDownload(t *testing.T) {
+	mux, _, a, b := replay(t)
+	tok := token(t, "a", api.ScopeReplay)
+
+	w := request(mux, "GET", "/replays/"+a.ID.String()+"/recording", tok)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	f, err := recording.NewFile(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Index()) != 4 {
+		t.Errorf("expected full recording with 4 chunks, got %d", len(f.Index()))
+	}
+
+	w = request(mux, "GET", "/replays/"+a.ID.String()+"/recording?from=11s&to=13s", tok)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	f, err = recording.NewFile(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index := f.Index(); len(index) != 1 || index[0].Start != time.Second*10 {
+		t.Errorf("expected slice holding only the chunk from 10s to 14s, got %+v", index)
+	}
+
+	decode(t, request(mux, "GET", "/replays/"+a.ID.String()+"/recording?from=soon", tok), http.StatusBadRequest, nil)
+	decode(t, request(mux, "GET", "/replays/"+b.ID.String()+"/recording", tok), http.StatusNotFound, nil)
+}
@@ -0,0 +1,108 @@
+package catalogue
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is an entry in the catalogue, describing a single recorded session.
+type Session struct {
+	// ID is the unique identifier of the session.
+	ID uuid.UUID `json:"id"`
+	// XUID is the XBOX Live user ID of the player the session belongs to.
+	XUID string `json:"xuid,omitempty"`
+	// DisplayName is the gamertag of the player the session belongs to.
+	DisplayName string `json:"display_name,omitempty"`
+	// Tenant is the network the session was recorded for.
+	Tenant string `json:"tenant,omitempty"`
+	// Proxy is the identifier of the proxy the session was recorded from.
+	Proxy string `json:"proxy,omitempty"`
+	// RemoteAddr is the network address of the proxy the session was recorded from.
+	RemoteAddr string `json:"remote_addr"`
+	// StartTime is the time at which the recording of the session was started.
+	StartTime time.Time `json:"start_time"`
+	// EndTime is the time at which the recording of the session was finalized. It is zero if the session is
+	// still being recorded, or if the server stopped before the recording could be finalized.
+	EndTime time.Time `json:"end_time,omitempty"`
+	// Packets is the amount of packets recorded.
+	Packets uint64 `json:"packets"`
+	// Flags is the amount of flags of Oomph detections recorded.
+	Flags int `json:"flags"`
+	// Size is the size of the recording in bytes.
+	Size int64 `json:"size"`
+	// Path is the path of the recording on disk.
+	Path string `json:"path"`
+}
+
+// Duration returns the duration of the session. If the session has not ended, zero is returned.
+func (s Session) Duration() time.Duration {
+	if s.EndTime.IsZero() {
+		return 0
+	}
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// Query is a query used to search the catalogue for sessions. Zero fields are not used to filter sessions.
+type Query struct {
+	// XUID matches sessions of the player with the XUID.
+	XUID string
+	// DisplayName matches sessions of players with the gamertag, ignoring case.
+	DisplayName string
+	// Tenant matches sessions recorded for the tenant.
+	Tenant string
+	// Proxy matches sessions recorded from the proxy.
+	Proxy string
+	// RemoteAddr matches sessions recorded from the network address.
+	RemoteAddr string
+	// From matches sessions that were active at or after the time.
+	From time.Time
+	// To matches sessions that were started at or before the time.
+	To time.Time
+	// MinDuration matches sessions that lasted at least the duration.
+	MinDuration time.Duration
+	// HasFlags matches sessions during which at least one detection flagged.
+	HasFlags bool
+	// Limit is the maximum amount of sessions returned.
+	Limit int
+}
+
+// Catalogue is a store of the metadata of all recorded sessions, used to find the recordings of a player.
+type Catalogue interface {
+	// Put inserts the session passed into the catalogue, replacing any session with the same ID.
+	Put(s Session) error
+	// Session returns the session with the ID passed. False is returned if no such session exists.
+	Session(id uuid.UUID) (Session, bool)
+	// Find returns all sessions matching the query passed, with the most recently started sessions first.
+	Find(q Query) ([]Session, error)
+	// Delete removes the session with the ID passed from the catalogue.
+	Delete(id uuid.UUID) error
+	// Close closes the catalogue and releases any resources it holds.
+	Close() error
+}
+
+// Match returns true if the session passed matches the query.
+func (q Query) Match(s Session) bool {
+	switch {
+	case q.XUID != "" && s.XUID != q.XUID:
+		return false
+	case q.DisplayName != "" && !strings.EqualFold(s.DisplayName, q.DisplayName):
+		return false
+	case q.Tenant != "" && s.Tenant != q.Tenant:
+		return false
+	case q.Proxy != "" && s.Proxy != q.Proxy:
+		return false
+	case q.RemoteAddr != "" && s.RemoteAddr != q.RemoteAddr:
+		return false
+	case !q.From.IsZero() && !s.EndTime.IsZero() && s.EndTime.Before(q.From):
+		return false
+	case !q.To.IsZero() && s.StartTime.After(q.To):
+		return false
+	case q.MinDuration > 0 && s.Duration() < q.MinDuration:
+		return false
+	case q.HasFlags && s.Flags == 0:
+		return false
+	}
+	return true
+}
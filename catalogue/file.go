@@ -0,0 +1,266 @@
+package catalogue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// record is a single line in the log of a FileCatalogue.
+type record struct {
+	// Session is the session that was put into the catalogue. It is nil if the record is a deletion.
+	Session *Session `json:"session,omitempty"`
+	// Deleted is the ID of the session that was deleted from the catalogue.
+	Deleted *uuid.UUID `json:"deleted,omitempty"`
+}
+
+// FileCatalogue is a Catalogue that keeps all sessions in memory, and persists them to an append-only log of
+// JSON records on disk. The log is compacted whenever the catalogue is opened.
+type FileCatalogue struct {
+	f *os.File
+	w *bufio.Writer
+
+	sessions map[uuid.UUID]Session
+	// byXUID and byName index the IDs of sessions by the XUID and the lower-cased gamertag of the player.
+	byXUID map[string]map[uuid.UUID]struct{}
+	byName map[string]map[uuid.UUID]struct{}
+
+	mu sync.RWMutex
+	// closed is true once the catalogue is closed. Sessions can no longer be put or deleted afterwards.
+	closed bool
+}
+
+// OpenFile opens the FileCatalogue at the path passed, creating it if it does not yet exist.
+func OpenFile(path string) (*FileCatalogue, error) {
+	c := &FileCatalogue{
+		sessions: make(map[uuid.UUID]Session),
+		byXUID:   make(map[string]map[uuid.UUID]struct{}),
+		byName:   make(map[string]map[uuid.UUID]struct{}),
+	}
+	if err := c.load(path); err != nil {
+		return nil, err
+	}
+	if err := c.compact(path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalogue: %v", err)
+	}
+	c.f, c.w = f, bufio.NewWriter(f)
+	return c, nil
+}
+
+func (c *FileCatalogue) Put(s Session) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("catalogue closed")
+	}
+	if err := c.append(record{Session: &s}); err != nil {
+		return err
+	}
+	c.remove(s.ID)
+	c.insert(s)
+	return nil
+}
+
+func (c *FileCatalogue) Session(id uuid.UUID) (Session, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok := c.sessions[id]
+	return s, ok
+}
+
+func (c *FileCatalogue) Find(q Query) ([]Session, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var sessions []Session
+	c.candidates(q, func(s Session) {
+		if q.Match(s) {
+			sessions = append(sessions, s)
+		}
+	})
+
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.StartTime.Compare(a.StartTime)
+	})
+	if q.Limit > 0 && len(sessions) > q.Limit {
+		sessions = sessions[:q.Limit]
+	}
+	return sessions, nil
+}
+
+func (c *FileCatalogue) Delete(id uuid.UUID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("catalogue closed")
+	}
+	if _, ok := c.sessions[id]; !ok {
+		return nil
+	}
+	if err := c.append(record{Deleted: &id}); err != nil {
+		return err
+	}
+	c.remove(id)
+	return nil
+}
+
+// Close flushes the log of the catalogue and closes it. Sessions put or deleted afterwards, for example by clients
+// that were abandoned during shutdown, are rejected with an error. Calling Close more than once has no effect.
+func (c *FileCatalogue) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if err := c.w.Flush(); err != nil {
+		_ = c.f.Close()
+		return fmt.Errorf("failed to flush catalogue: %v", err)
+	}
+	return c.f.Close()
+}
+
+// candidates calls f for every session that could match the query passed, using the indexes of the catalogue
+// where possible.
+func (c *FileCatalogue) candidates(q Query, f func(s Session)) {
+	var ids map[uuid.UUID]struct{}
+	switch {
+	case q.XUID != "":
+		ids = c.byXUID[q.XUID]
+	case q.DisplayName != "":
+		ids = c.byName[strings.ToLower(q.DisplayName)]
+	default:
+		for _, s := range c.sessions {
+			f(s)
+		}
+		return
+	}
+	for id := range ids {
+		f(c.sessions[id])
+	}
+}
+
+// append writes the record passed to the log of the catalogue.
+func (c *FileCatalogue) append(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode catalogue record: %v", err)
+	}
+	_, _ = c.w.Write(data)
+	_ = c.w.WriteByte('\n')
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write catalogue record: %v", err)
+	}
+	return nil
+}
+
+// insert adds the session passed to the catalogue and its indexes.
+func (c *FileCatalogue) insert(s Session) {
+	c.sessions[s.ID] = s
+	if s.XUID != "" {
+		addIndex(c.byXUID, s.XUID, s.ID)
+	}
+	if s.DisplayName != "" {
+		addIndex(c.byName, strings.ToLower(s.DisplayName), s.ID)
+	}
+}
+
+// remove removes the session with the ID passed from the catalogue and its indexes.
+func (c *FileCatalogue) remove(id uuid.UUID) {
+	s, ok := c.sessions[id]
+	if !ok {
+		return
+	}
+	delete(c.sessions, id)
+	removeIndex(c.byXUID, s.XUID, id)
+	removeIndex(c.byName, strings.ToLower(s.DisplayName), id)
+}
+
+// load reads all records from the log at the path passed. Lines that cannot be decoded, such as a partially
+// written last line, are skipped.
+func (c *FileCatalogue) load(path string) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open catalogue: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		switch {
+		case r.Session != nil:
+			c.remove(r.Session.ID)
+			c.insert(*r.Session)
+		case r.Deleted != nil:
+			c.remove(*r.Deleted)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read catalogue: %v", err)
+	}
+	return nil
+}
+
+// compact rewrites the log at the path passed so that it only holds the sessions currently in the catalogue.
+func (c *FileCatalogue) compact(path string) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to compact catalogue: %v", err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, s := range c.sessions {
+		if err := enc.Encode(record{Session: &s}); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to compact catalogue: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to compact catalogue: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to compact catalogue: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func addIndex(index map[string]map[uuid.UUID]struct{}, key string, id uuid.UUID) {
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[uuid.UUID]struct{})
+		index[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func removeIndex(index map[string]map[uuid.UUID]struct{}, key string, id uuid.UUID) {
+	if ids, ok := index[key]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(index, key)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package catalogue_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/catalogue"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// open opens a FileCatalogue at the path passed, closing it when the test ends.
+func open(t *testing.T, path string) *catalogue.FileCatalogue {
+	t.Helper()
+	c, err := catalogue.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c
+}
+
+// put puts the sessions passed into the catalogue.
+func put(t *testing.T, c catalogue.Catalogue, sessions ...catalogue.Session) {
+	t.Helper()
+	for _, s := range sessions {
+		if err := c.Put(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "sessions.log"))
+	steve := catalogue.Session{ID: uuid.New(), XUID: "2535400000000001", DisplayName: "Steve", Tenant: "a", StartTime: start, EndTime: start.Add(time.Hour)}
+	alex := catalogue.Session{ID: uuid.New(), DisplayName: "Alex", Tenant: "a", StartTime: start.Add(time.Hour), Flags: 2}
+	other := catalogue.Session{ID: uuid.New(), DisplayName: "steve", Tenant: "b", StartTime: start.Add(time.Hour * 2), EndTime: start.Add(time.Hour * 3)}
+	put(t, c, steve, alex, other)
+
+	tests := map[string]struct {
+		q        catalogue.Query
+		expected []uuid.UUID
+	}{
+		"all":          {q: catalogue.Query{}, expected: []uuid.UUID{other.ID, alex.ID, steve.ID}},
+		"xuid":         {q: catalogue.Query{XUID: steve.XUID}, expected: []uuid.UUID{steve.ID}},
+		"name":         {q: catalogue.Query{DisplayName: "STEVE"}, expected: []uuid.UUID{other.ID, steve.ID}},
+		"tenant":       {q: catalogue.Query{Tenant: "a"}, expected: []uuid.UUID{alex.ID, steve.ID}},
+		"from":         {q: catalogue.Query{From: start.Add(time.Hour * 2)}, expected: []uuid.UUID{other.ID, alex.ID}},
+		"to":           {q: catalogue.Query{To: start.Add(time.Minute)}, expected: []uuid.UUID{steve.ID}},
+		"min duration": {q: catalogue.Query{MinDuration: time.Hour}, expected: []uuid.UUID{other.ID, steve.ID}},
+		"has flags":    {q: catalogue.Query{HasFlags: true}, expected: []uuid.UUID{alex.ID}},
+		"limit":        {q: catalogue.Query{Limit: 1}, expected: []uuid.UUID{other.ID}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sessions, err := c.Find(test.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != len(test.expected) {
+				t.Fatalf("expected %d sessions, got %d", len(test.expected), len(sessions))
+			}
+			for i, s := range sessions {
+				if s.ID != test.expected[i] {
+					t.Errorf("expected session %d to be %s, got %s", i, test.expected[i], s.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	c, err := catalogue.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := catalogue.Session{ID: uuid.New(), XUID: "1", DisplayName: "Steve", StartTime: start}
+	deleted := catalogue.Session{ID: uuid.New(), XUID: "2", StartTime: start}
+	put(t, c, kept, deleted)
+	kept.Packets = 10
+	put(t, c, kept)
+	if err := c.Delete(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record that was only partially written before a crash must be skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"session":{"id":`)
+	_ = f.Close()
+
+	c = open(t, path)
+	if s, ok := c.Session(kept.ID); !ok || s.Packets != 10 {
+		t.Errorf("expected latest version of session to be loaded, got %+v", s)
+	}
+	if _, ok := c.Session(deleted.ID); ok {
+		t.Error("expected deleted session not to be loaded")
+	}
+	if sessions, _ := c.Find(catalogue.Query{XUID: "2"}); len(sessions) != 0 {
+		t.Error("expected deleted session to be removed from the XUID index")
+	}
+	if sessions, _ := c.Find(catalogue.Query{DisplayName: "steve"}); len(sessions) != 1 {
+		t.Error("expected session to be found by its name after reopening")
+	}
+}
+
+func TestForTenant(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "sessions.log"))
+	a := catalogue.Session{ID: uuid.New(), Tenant: "a", StartTime: start}
+	b := catalogue.Session{ID: uuid.New(), Tenant: "b", StartTime: start}
+	put(t, c, a, b)
+
+	view := catalogue.ForTenant(c, "a")
+	if _, ok := view.Session(b.ID); ok {
+		t.Error("expected session of other tenant to be hidden")
+	}
+	if sessions, _ := view.Find(catalogue.Query{}); len(sessions) != 1 || sessions[0].ID != a.ID {
+		t.Errorf("expected only sessions of tenant to be found, got %+v", sessions)
+	}
+	if sessions, _ := view.Find(catalogue.Query{Tenant: "b"}); len(sessions) != 0 {
+		t.Errorf("expected no sessions when querying other tenant, got %+v", sessions)
+	}
+	if err := view.Put(catalogue.Session{ID: b.ID, Tenant: "a"}); err == nil {
+		t.Error("expected overwriting session of other tenant to fail")
+	}
+	if err := view.Delete(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Session(b.ID); !ok {
+		t.Error("expected session of other tenant not to be deleted")
+	}
+	if err := view.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Session(a.ID); !ok {
+		t.Error("expected closing the view not to close the catalogue")
+	}
+}
+
+func TestClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	c := open(t, path)
+	s := catalogue.Session{ID: uuid.New(), StartTime: start}
+	put(t, c, s)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("expected closing twice to have no effect, got %v", err)
+	}
+
+	// Clients abandoned during shutdown may still update their session after the catalogue is closed.
+	if err := c.Put(catalogue.Session{ID: uuid.New(), StartTime: start}); err == nil {
+		t.Error("expected put after close to be rejected")
+	}
+	if err := c.Delete(s.ID); err == nil {
+		t.Error("expected delete after close to be rejected")
+	}
+	if _, ok := c.Session(s.ID); !ok {
+		t.Error("expected session to remain after rejected delete")
+	}
+	if sessions, _ := open(t, path).Find(catalogue.Query{}); len(sessions) != 1 {
+		t.Errorf("expected only the session put before closing to be persisted, got %+v", sessions)
+	}
+}
@@ -0,0 +1,57 @@
+package catalogue
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// tenantCatalogue is a Catalogue limited to the sessions of a single tenant.
+type tenantCatalogue struct {
+	c      Catalogue
+	tenant string
+}
+
+// ForTenant returns a view of the catalogue passed that is limited to the sessions of the tenant passed. Sessions
+// of other tenants can neither be read, found, modified nor deleted through the view. Closing the view does not
+// close the underlying catalogue.
+func ForTenant(c Catalogue, tenant string) Catalogue {
+	return tenantCatalogue{c: c, tenant: tenant}
+}
+
+func (t tenantCatalogue) Put(s Session) error {
+	if s.Tenant != t.tenant {
+		return fmt.Errorf("session belongs to tenant %q, expected %q", s.Tenant, t.tenant)
+	}
+	if existing, ok := t.c.Session(s.ID); ok && existing.Tenant != t.tenant {
+		return fmt.Errorf("session %s belongs to another tenant", s.ID)
+	}
+	return t.c.Put(s)
+}
+
+func (t tenantCatalogue) Session(id uuid.UUID) (Session, bool) {
+	s, ok := t.c.Session(id)
+	if !ok || s.Tenant != t.tenant {
+		return Session{}, false
+	}
+	return s, true
+}
+
+func (t tenantCatalogue) Find(q Query) ([]Session, error) {
+	if q.Tenant != "" && q.Tenant != t.tenant {
+		return nil, nil
+	}
+	q.Tenant = t.tenant
+	return t.c.Find(q)
+}
+
+func (t tenantCatalogue) Delete(id uuid.UUID) error {
+	if _, ok := t.Session(id); !ok {
+		return nil
+	}
+	return t.c.Delete(id)
+}
+
+func (t tenantCatalogue) Close() error {
+	return nil
+}
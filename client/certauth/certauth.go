@@ -0,0 +1,66 @@
+// Package certauth maps the TLS client certificates presented by proxies to proxy identities.
+package certauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scheme is the URI scheme of the SAN used to encode a proxy identity in a certificate, in the form of
+// "oomph://<tenant>/<proxy>".
+const Scheme = "oomph"
+
+// Identity is the identity of a proxy, derived from the client certificate it presented.
+type Identity struct {
+	// Tenant is the ID of the network the proxy belongs to.
+	Tenant string
+	// Proxy is the ID of the proxy.
+	Proxy string
+}
+
+// FromCertificate returns the identity of the proxy the certificate passed was issued to. The identity is read
+// from a URI SAN with the Scheme if present, and otherwise from the subject, using the first organization as the
+// tenant and the common name as the proxy.
+func FromCertificate(cert *x509.Certificate) (Identity, error) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme != Scheme {
+			continue
+		}
+		proxy := strings.Trim(uri.Path, "/")
+		if uri.Host == "" || proxy == "" || strings.Contains(proxy, "/") {
+			return Identity{}, fmt.Errorf("malformed identity URI %q, expected %s://<tenant>/<proxy>", uri, Scheme)
+		}
+		return Identity{Tenant: uri.Host, Proxy: proxy}, nil
+	}
+
+	if len(cert.Subject.Organization) == 0 || cert.Subject.CommonName == "" {
+		return Identity{}, fmt.Errorf("certificate has no %s URI SAN, and no organization and common name in its subject", Scheme)
+	}
+	return Identity{Tenant: cert.Subject.Organization[0], Proxy: cert.Subject.CommonName}, nil
+}
+
+// FromConnectionState returns the identity of the proxy from the verified client certificate in the TLS
+// connection state passed. False is returned if the proxy did not present a verified certificate.
+func FromConnectionState(state tls.ConnectionState) (Identity, bool, error) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return Identity{}, false, nil
+	}
+	id, err := FromCertificate(state.VerifiedChains[0][0])
+	return id, err == nil, err
+}
+
+// LoadCAPool loads a pool of CA certificates from the PEM bundle at the path passed.
+func LoadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA bundle %s holds no certificates", path)
+	}
+	return pool, nil
+}
@@ -6,14 +6,46 @@ import (
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/client/certauth"
+	"github.com/oomph-ac/ocloud/client/identity"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
 	"github.com/quic-go/quic-go"
 	"github.com/rs/zerolog"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
 
+// Config holds the options of a client that are configurable by the server.
+type Config struct {
+	// FlushInterval is the interval at which packets written to the client are flushed to the proxy.
+	FlushInterval time.Duration
+	// CompressionLevel is the zlib compression level used for batches written to the proxy.
+	CompressionLevel int
+	// MaxBatchSize is the maximum size of a compressed batch sent by the proxy.
+	MaxBatchSize int
+	// ReadBufferSize is the size of the buffer holding a decompressed batch sent by the proxy. Batches
+	// decompressing to more bytes are rejected.
+	ReadBufferSize int
+	// WriteBufferSize is the initial size of the buffer holding packets written to the proxy before they are
+	// flushed.
+	WriteBufferSize int
+}
+
+// DefaultConfig returns the default client options.
+func DefaultConfig() Config {
+	return Config{
+		FlushInterval:    time.Millisecond * 500,
+		CompressionLevel: 7,
+		MaxBatchSize:     cloudpacket.MaxExpectedPacketSize,
+		ReadBufferSize:   10 * 1024 * 1024,
+		WriteBufferSize:  65535,
+	}
+}
+
 const (
 	// ClientReadModePacketLength is the read mode where the client is reading the length of the packet.
 	ClientReadModePacketLength byte = iota
@@ -22,13 +54,38 @@ const (
 	ClientReadModePacketData
 )
 
+// Protocol holds the options negotiated with the proxy during the handshake.
+type Protocol struct {
+	// Version is the version of the oCloud protocol implemented by the proxy.
+	Version uint32
+	// MinecraftProtocol is the Minecraft protocol version of the game packets forwarded by the proxy.
+	MinecraftProtocol int32
+	// Compression is the compression algorithm used for batches.
+	Compression byte
+	// Packets is the list of IDs of the packets the proxy may send.
+	Packets []uint32
+}
+
 type Client struct {
 	conn quic.Stream
 	addr net.Addr
+	cfg  Config
+
+	// sessionID is the unique identifier of the session this client belongs to. A session is created
+	// for every stream opened by a proxy.
+	sessionID uuid.UUID
+	// connectedAt is the time at which the stream of the client was accepted.
+	connectedAt time.Time
+	// packetsReceived and bytesReceived are the amount of packets and compressed bytes received from the proxy.
+	packetsReceived atomic.Uint64
+	bytesReceived   atomic.Uint64
 
 	log zerolog.Logger
 
+	// compressor compresses every batch written to the proxy into cBuffer, which holds the compressed batch until
+	// it is written to the underlying connection.
 	compressor *zlib.Writer
+	cBuffer    *bytes.Buffer
 
 	// rBuffer is the buffer that is used to read packets from the underlying connection. Specifically, this buffer
 	// contains the de-compressed data from the underlying connection. Only one goroutine accesses this buffer, so
@@ -48,7 +105,10 @@ type Client struct {
 	protoWriter atomic.Pointer[protocol.Writer]
 
 	handlers map[uuid.UUID]PacketHandler
-	hMu      sync.RWMutex
+	// handlerOrder holds the IDs of the registered handlers in the order they were registered. Handlers are
+	// called in this order, so that a handler may rely on the state set by the handlers registered before it.
+	handlerOrder []uuid.UUID
+	hMu          sync.RWMutex
 
 	// deferredPackets is a channel that is used when there are no handlers registered to this client.
 	// It will be read from when at least one handler is registered.
@@ -56,6 +116,29 @@ type Client struct {
 	close           chan struct{}
 	onceClose       sync.Once
 
+	// proto is the protocol negotiated with the proxy. It is nil until the handshake is completed.
+	proto atomic.Pointer[Protocol]
+	// identity is the identity of the player the session belongs to. It is nil until the proxy sends
+	// a PlayerInfo packet.
+	identity atomic.Pointer[identity.Identity]
+
+	// certIdentity is the identity of the proxy derived from its verified client certificate. It is nil if
+	// the proxy did not present a client certificate.
+	certIdentity atomic.Pointer[certauth.Identity]
+	// claims are the claims of the token the proxy authenticated with. They are nil until the proxy is
+	// authenticated.
+	claims atomic.Pointer[jwt.Claims]
+	// tokenExpiry is the time at which the token the proxy authenticated with expires, and expiryTimer is the
+	// timer that disconnects the client at that time, unless the proxy re-authenticates before then.
+	tokenExpiry time.Time
+	expiryTimer *time.Timer
+	expiryMu    sync.Mutex
+
+	// batchMu is held while a batch is being processed, and draining is set once the client should no longer
+	// process new batches. Together they allow Drain to wait for the batch in flight to be processed.
+	batchMu  sync.Mutex
+	draining atomic.Bool
+
 	authenticated atomic.Bool
 	connected     atomic.Bool
 }
@@ -64,31 +147,58 @@ func New(
 	conn quic.Stream,
 	addr net.Addr,
 	log zerolog.Logger,
+	cfg Config,
 ) *Client {
 	c := &Client{
-		conn: conn,
-		addr: addr,
+		conn:        conn,
+		addr:        addr,
+		cfg:         cfg,
+		sessionID:   uuid.New(),
+		connectedAt: time.Now(),
 
 		log: log,
 
-		rBuffer: bytes.NewBuffer(make([]byte, 10*1024*1024)),
-		wBuffer: bytes.NewBuffer(make([]byte, 0, 65535)),
+		rBuffer: bytes.NewBuffer(make([]byte, 0, cfg.ReadBufferSize)),
+		wBuffer: bytes.NewBuffer(make([]byte, 0, cfg.WriteBufferSize)),
+		cBuffer: bytes.NewBuffer(make([]byte, 0, cloudpacket.HeaderSize+cfg.WriteBufferSize)),
 
+		handlers:        make(map[uuid.UUID]PacketHandler),
 		close:           make(chan struct{}, 1),
 		deferredPackets: make(chan packet.Packet, 65535),
 	}
 
-	c.compressor, _ = zlib.NewWriterLevel(conn, 7)
+	c.compressor, _ = zlib.NewWriterLevel(c.cBuffer, cfg.CompressionLevel)
 	c.connected.Store(true)
 
-	// The shield ID is set to zero for now, until the client sends a ClientInfo packet which specifies what the shield ID is.
+	// The shield ID is set to zero for now, until the client sends a PlayerInfo packet which specifies what the
+	// shield ID is.
 	c.protoReader.Store(protocol.NewReader(c.rBuffer, 0, false))
 	c.protoWriter.Store(protocol.NewWriter(c.wBuffer, 0))
 
 	go c.startTicking()
+	go c.startFlushing()
 	return c
 }
 
+// Config returns the options the client was created with.
+func (c *Client) Config() Config {
+	return c.cfg
+}
+
+// Protocol returns the protocol negotiated with the proxy. False is returned if the handshake has not yet
+// been completed.
+func (c *Client) Protocol() (Protocol, bool) {
+	if p := c.proto.Load(); p != nil {
+		return *p, true
+	}
+	return Protocol{}, false
+}
+
+// SetProtocol sets the protocol negotiated with the proxy, completing the handshake.
+func (c *Client) SetProtocol(p Protocol) {
+	c.proto.Store(&p)
+}
+
 func (c *Client) Authenticated() bool {
 	return c.authenticated.Load()
 }
@@ -97,6 +207,113 @@ func (c *Client) SetAuthenticated(authenticated bool) {
 	c.authenticated.Store(authenticated)
 }
 
+// CertificateIdentity returns the identity of the proxy derived from its verified client certificate. False is
+// returned if the proxy did not present a client certificate.
+func (c *Client) CertificateIdentity() (certauth.Identity, bool) {
+	if id := c.certIdentity.Load(); id != nil {
+		return *id, true
+	}
+	return certauth.Identity{}, false
+}
+
+// SetCertificateIdentity sets the identity of the proxy derived from its verified client certificate.
+func (c *Client) SetCertificateIdentity(id certauth.Identity) {
+	c.certIdentity.Store(&id)
+}
+
+// Claims returns the claims of the token the proxy authenticated with, or nil if the proxy is not authenticated.
+func (c *Client) Claims() *jwt.Claims {
+	return c.claims.Load()
+}
+
+// Tenant returns the ID of the tenant the proxy belongs to, derived from the token or certificate it
+// authenticated with. It is empty if the proxy is not authenticated.
+func (c *Client) Tenant() string {
+	if claims := c.Claims(); claims != nil {
+		return claims.Tenant
+	}
+	return ""
+}
+
+// SetClaims sets the claims of the token the proxy authenticated with.
+func (c *Client) SetClaims(claims *jwt.Claims) {
+	c.claims.Store(claims)
+}
+
+// TokenExpiry returns the time at which the token the proxy authenticated with expires. It is zero if the
+// token does not expire.
+func (c *Client) TokenExpiry() time.Time {
+	c.expiryMu.Lock()
+	defer c.expiryMu.Unlock()
+
+	return c.tokenExpiry
+}
+
+// SetTokenExpiry sets the time at which the token the proxy authenticated with expires. The client is
+// disconnected once the leeway passed has elapsed after that time, which should match the clock skew allowed when
+// the token was validated, unless SetTokenExpiry is called again with a later time after the proxy
+// re-authenticated. A zero time means the token does not expire.
+func (c *Client) SetTokenExpiry(expiry time.Time, leeway time.Duration) {
+	c.expiryMu.Lock()
+	defer c.expiryMu.Unlock()
+
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+	c.tokenExpiry = expiry
+	if expiry.IsZero() || !c.connected.Load() {
+		return
+	}
+	c.expiryTimer = time.AfterFunc(time.Until(expiry.Add(leeway)), func() {
+		c.Close(DisconnectErrorf(cloudpacket.DisconnectReasonTokenExpired, "authentication token expired at %s", expiry.Format(time.RFC3339)))
+	})
+}
+
+// SessionID returns the unique identifier of the session the client belongs to.
+func (c *Client) SessionID() uuid.UUID {
+	return c.sessionID
+}
+
+// ConnectedAt returns the time at which the stream of the client was accepted.
+func (c *Client) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// PacketsReceived returns the amount of packets received from the proxy.
+func (c *Client) PacketsReceived() uint64 {
+	return c.packetsReceived.Load()
+}
+
+// BytesReceived returns the amount of bytes received from the proxy, before decompression.
+func (c *Client) BytesReceived() uint64 {
+	return c.bytesReceived.Load()
+}
+
+// Identity returns the identity of the player the session belongs to. False is returned if the proxy has not
+// yet sent the identity of the player.
+func (c *Client) Identity() (identity.Identity, bool) {
+	if id := c.identity.Load(); id != nil {
+		return *id, true
+	}
+	return identity.Identity{}, false
+}
+
+// SetIdentity sets the identity of the player the session belongs to.
+func (c *Client) SetIdentity(id identity.Identity) {
+	c.identity.Store(&id)
+}
+
+// SetShieldID replaces the protocol reader and writer of the client with ones using the shield ID passed. The
+// shield ID is required to properly encode/decode items of the player.
+func (c *Client) SetShieldID(shieldID int32) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.protoReader.Store(protocol.NewReader(c.rBuffer, shieldID, false))
+	c.protoWriter.Store(protocol.NewWriter(c.wBuffer, shieldID))
+}
+
 // Address returns the network address of the client.
 func (c *Client) Addr() net.Addr {
 	return c.addr
@@ -122,7 +339,27 @@ func (c *Client) SetWriter(writer *protocol.Writer) {
 	c.protoWriter.Store(writer)
 }
 
-// Close closes the stream to the underlying stream. An error is returned if the close fails.
+// Drain stops the client from processing any further batches, and waits for the batch currently being
+// processed, if any, to be fully handled. The client must still be closed afterwards.
+func (c *Client) Drain() {
+	c.draining.Store(true)
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+}
+
+// DeferredPackets returns the amount of packets queued until a handler is registered.
+func (c *Client) DeferredPackets() int {
+	return len(c.deferredPackets)
+}
+
+// Done returns a channel that is closed once the client is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.close
+}
+
+// Close closes the stream to the underlying stream. If the error passed is non-nil, a Disconnect packet is sent
+// to the proxy before the stream is closed, with the reason of the error if it is a DisconnectError. An error is
+// returned if the close fails.
 func (c *Client) Close(err error) (closeErr error) {
 	c.onceClose.Do(func() {
 		if err != nil {
@@ -130,21 +367,20 @@ func (c *Client) Close(err error) (closeErr error) {
 				Err(err).
 				Str("addr", c.addr.String()).
 				Msg("client closed")
+			c.sendDisconnect(err)
 		}
 
 		c.connected.Store(false)
+		c.SetTokenExpiry(time.Time{}, 0)
 
 		close(c.deferredPackets)
 		close(c.close)
 
-		c.compressor.Close()
-		c.rBuffer = nil
-
 		c.hMu.Lock()
-		for _, handler := range c.handlers {
-			_ = handler.Close()
+		for _, id := range c.handlerOrder {
+			_ = c.handlers[id].Close()
 		}
-		c.handlers = nil
+		c.handlers, c.handlerOrder = nil, nil
 		c.hMu.Unlock()
 
 		closeErr = c.conn.Close()
@@ -17,6 +17,7 @@ func NewPacketCtx(pk packet.Packet) *PacketContext {
 	}
 }
 
+// Cancel cancels the packet, preventing it from being passed to any handlers registered after the current one.
 func (ctx *PacketContext) Cancel() {
 	if ctx.completed {
 		panic("cannot use completed packet context")
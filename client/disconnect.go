@@ -0,0 +1,64 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+)
+
+// disconnectTimeout is the maximum time spent writing the Disconnect packet to the proxy.
+const disconnectTimeout = time.Second
+
+// DisconnectError is an error that causes the client to be disconnected with a specific reason. Handlers may
+// set a DisconnectError on a packet context to choose the reason sent to the proxy.
+type DisconnectError struct {
+	// Reason is the reason sent to the proxy in the Disconnect packet.
+	Reason byte
+	// Err is the underlying error.
+	Err error
+}
+
+// DisconnectErrorf returns a DisconnectError with the reason passed, and an error formatted according to the
+// format specifier.
+func DisconnectErrorf(reason byte, format string, a ...any) error {
+	return &DisconnectError{Reason: reason, Err: fmt.Errorf(format, a...)}
+}
+
+func (e *DisconnectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DisconnectError) Unwrap() error {
+	return e.Err
+}
+
+// Disconnect disconnects the client with the reason and message passed.
+func (c *Client) Disconnect(reason byte, message string) error {
+	return c.Close(&DisconnectError{Reason: reason, Err: errors.New(message)})
+}
+
+// disconnectReason returns the reason to disconnect the client with for the error passed. If the error is not
+// a DisconnectError, the fallback reason passed is returned.
+func disconnectReason(err error, fallback byte) byte {
+	var disconnectErr *DisconnectError
+	if errors.As(err, &disconnectErr) {
+		return disconnectErr.Reason
+	}
+	return fallback
+}
+
+// sendDisconnect writes a Disconnect packet with the reason for the error passed, and flushes it to the
+// proxy. Errors are ignored, as the connection may already be broken.
+func (c *Client) sendDisconnect(err error) {
+	if !c.connected.Load() {
+		return
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(disconnectTimeout))
+	_ = c.Write(&cloudpacket.Disconnect{
+		Reason:  disconnectReason(err, cloudpacket.DisconnectReasonUnknown),
+		Message: err.Error(),
+	})
+	_ = c.Flush()
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"maps"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/oomph-ac/ocloud/client/context"
@@ -18,27 +19,39 @@ type PacketHandler interface {
 	Close() error
 }
 
-// RegisterHandlers registers multiple handlers at once with the client.
+// RegisterHandlers registers multiple handlers at once with the client. Handlers are called in the order
+// they are registered.
 func (c *Client) RegisterHandlers(handlers ...PacketHandler) {
 	c.hMu.Lock()
 	defer c.hMu.Unlock()
 
 	for _, handler := range handlers {
+		// The handlers are set to nil once the client is closed, in which case the handler is closed right away.
+		if c.handlers == nil {
+			_ = handler.Close()
+			continue
+		}
 		randUuid, _ := uuid.NewRandom()
 		handler.SetID(randUuid)
 		c.handlers[randUuid] = handler
+		c.handlerOrder = append(c.handlerOrder, randUuid)
 	}
 }
 
-// RegisterHandler registers a packet handler with the client. It returns a UUID that can be used to later unregister
-// the handler.
+// RegisterHandler registers a packet handler with the client. The UUID set on the handler can be used to later
+// unregister the handler. If the client is already closed, the handler is closed immediately.
 func (c *Client) RegisterHandler(handler PacketHandler) {
 	c.hMu.Lock()
 	defer c.hMu.Unlock()
 
+	if c.handlers == nil {
+		_ = handler.Close()
+		return
+	}
 	randUuid, _ := uuid.NewRandom()
 	handler.SetID(randUuid)
 	c.handlers[randUuid] = handler
+	c.handlerOrder = append(c.handlerOrder, randUuid)
 }
 
 // UnregisterHandler unregisters a packet handler with the client.
@@ -49,7 +62,22 @@ func (c *Client) UnregisterHandler(uuid uuid.UUID) {
 	if h, ok := c.handlers[uuid]; ok {
 		_ = h.Close()
 		delete(c.handlers, uuid)
+		if i := slices.Index(c.handlerOrder, uuid); i != -1 {
+			c.handlerOrder = slices.Delete(c.handlerOrder, i, i+1)
+		}
+	}
+}
+
+// OrderedHandlers returns the handlers registered with the client, in the order they are called.
+func (c *Client) OrderedHandlers() []PacketHandler {
+	c.hMu.RLock()
+	defer c.hMu.RUnlock()
+
+	handlers := make([]PacketHandler, 0, len(c.handlerOrder))
+	for _, id := range c.handlerOrder {
+		handlers = append(handlers, c.handlers[id])
 	}
+	return handlers
 }
 
 // Handlers returns a cloned map of the handlers registered with the client.
@@ -2,21 +2,69 @@ package handler
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/oomph-ac/ocloud/client"
 	"github.com/oomph-ac/ocloud/client/context"
 	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/metrics"
 	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/tenant"
 )
 
+// AuthMode determines the credentials a proxy must present to be authenticated.
+type AuthMode int
+
+const (
+	// AuthModeToken requires the proxy to authenticate with a valid token. Client certificates are ignored.
+	AuthModeToken AuthMode = iota
+	// AuthModeCertificate requires the proxy to present a verified client certificate. The token in the
+	// Authenticate packet is ignored, but the packet must still be sent to complete authentication.
+	AuthModeCertificate
+	// AuthModeTokenAndCertificate requires the proxy to authenticate with a valid token and to present a verified
+	// client certificate, with the tenant and proxy of both matching.
+	AuthModeTokenAndCertificate
+)
+
+// ParseAuthMode parses an AuthMode from its name, which is one of "token", "certificate" or "both".
+func ParseAuthMode(s string) (AuthMode, error) {
+	switch s {
+	case "token":
+		return AuthModeToken, nil
+	case "certificate":
+		return AuthModeCertificate, nil
+	case "both":
+		return AuthModeTokenAndCertificate, nil
+	}
+	return 0, fmt.Errorf("unknown authentication mode %q", s)
+}
+
+// RequiresCertificate returns true if the mode requires proxies to present a client certificate.
+func (m AuthMode) RequiresCertificate() bool {
+	return m == AuthModeCertificate || m == AuthModeTokenAndCertificate
+}
+
+// AuthenticationHandler is a packet handler that authenticates the proxy using the token in the Authenticate
+// packet. It stays registered once the proxy is authenticated, so that the proxy may re-authenticate with a
+// fresh token before its current token expires.
 type AuthenticationHandler struct {
 	mClient *client.Client
 	id      uuid.UUID
+
+	// mode is the mode determining the credentials the proxy must present.
+	mode AuthMode
+	// revocations is the store checked for revoked tokens.
+	revocations *jwt.RevocationStore
+	// tenants is the manager enforcing the limits of the tenant of the proxy.
+	tenants *tenant.Manager
+	// closeStream releases the stream of the proxy from the limits of its tenant. It is set once the proxy is
+	// authenticated.
+	closeStream func()
 }
 
-func NewAuthenticationHandler(c *client.Client) *AuthenticationHandler {
-	return &AuthenticationHandler{mClient: c}
+func NewAuthenticationHandler(c *client.Client, mode AuthMode, revocations *jwt.RevocationStore, tenants *tenant.Manager) *AuthenticationHandler {
+	return &AuthenticationHandler{mClient: c, mode: mode, revocations: revocations, tenants: tenants}
 }
 
 func (h *AuthenticationHandler) SetID(id uuid.UUID) {
@@ -24,29 +72,159 @@ func (h *AuthenticationHandler) SetID(id uuid.UUID) {
 }
 
 func (h *AuthenticationHandler) Recieve(ctx *context.PacketContext) {
-	// If the client is already authenticated, this handler is no longer required.
 	c := h.mClient
+	pk, ok := ctx.Packet().(*cloudpacket.Authenticate)
 	if c.Authenticated() {
+		// Once authenticated, the only packets relevant to this handler are those refreshing the token.
+		if ok {
+			ctx.Cancel()
+			h.refresh(ctx, pk)
+		}
 		return
 	}
 
-	pk, ok := ctx.Packet().(*cloudpacket.Authenticate)
 	if !ok {
 		ctx.SetError(fmt.Errorf("expected authentication packet, got %T", ctx.Packet()))
 		return
 	}
-	if _, ok := jwt.Validate(pk.Token); !ok {
-		ctx.SetError(fmt.Errorf("unable to validate authentication token"))
+	// The token must never be passed on to other handlers, such as the recorder.
+	ctx.Cancel()
+
+	claims, reason, err := h.validate(pk)
+	if err != nil {
+		// The response is flushed along with the Disconnect packet when the client is closed.
+		h.reject(reason)
+		ctx.SetError(client.DisconnectErrorf(cloudpacket.DisconnectReasonAuthenticationFailed, "unable to validate authentication token: %v", err))
+		return
+	}
+	closeStream, err := h.tenants.OpenStream(claims.Tenant)
+	if err != nil {
+		metrics.Authentications.WithLabelValues("failure", "quota_exceeded").Inc()
+		_ = c.Write(&cloudpacket.AuthenticateResponse{SessionID: c.SessionID()})
+		ctx.SetError(&client.DisconnectError{Reason: cloudpacket.DisconnectReasonQuotaExceeded, Err: err})
+		return
+	}
+	h.closeStream = closeStream
+	if err := h.respond(claims); err != nil {
+		ctx.SetError(err)
 		return
 	}
 
-	// Now that we are authenticated, we can remove this handler from the client and set the client to
-	// authenticated. We use a goroutine to unregister the handler to avoid a deadlock.
-	go c.UnregisterHandler(h.id)
+	metrics.Authentications.WithLabelValues("success", "").Inc()
+
+	// Now that we are authenticated, we can register a handler watching for the token to be revoked, and set
+	// the client to authenticated. We use a goroutine to register the handler to avoid a deadlock.
+	c.SetClaims(claims)
+	c.SetTokenExpiry(expiry(claims), leeway())
 	c.SetAuthenticated(true)
+	go c.RegisterHandler(NewRevocationWatcher(c, h.revocations))
+}
+
+// refresh handles an Authenticate packet sent by an authenticated proxy to replace its token before it expires.
+// The new token must belong to the same tenant and proxy as the token the proxy authenticated with. If the new
+// token is rejected, a failed AuthenticateResponse is written but the session is kept, as the current token is
+// still valid. The session is then closed once the current token expires, unless the proxy refreshes it in time.
+func (h *AuthenticationHandler) refresh(ctx *context.PacketContext, pk *cloudpacket.Authenticate) {
+	c := h.mClient
+	claims, reason, err := h.validate(pk)
+	if current := c.Claims(); err == nil && (claims.Tenant != current.Tenant || claims.Proxy != current.Proxy) {
+		reason = "identity_mismatch"
+	}
+	if reason != "" {
+		h.reject(reason)
+		return
+	}
+	if err := h.respond(claims); err != nil {
+		ctx.SetError(err)
+		return
+	}
+
+	metrics.Authentications.WithLabelValues("refreshed", "").Inc()
+	c.SetClaims(claims)
+	c.SetTokenExpiry(expiry(claims), leeway())
+}
+
+// validate validates the credentials of the proxy, depending on the authentication mode, and checks that they
+// hold a valid tenant and were not revoked. If the credentials are invalid, an error is returned along with the
+// reason the credentials were rejected, which is used as the label of the authentication metric.
+func (h *AuthenticationHandler) validate(pk *cloudpacket.Authenticate) (*jwt.Claims, string, error) {
+	claims, err := h.credentials(pk.Token)
+	if err != nil {
+		return nil, "invalid_credentials", err
+	}
+	if err := tenant.Validate(claims.Tenant); err != nil {
+		return nil, "invalid_tenant", err
+	}
+	if r, ok := h.revocations.Revoked(claims); ok {
+		return nil, "revoked", fmt.Errorf("token revoked (%s %s)", r.Kind, r.Value)
+	}
+	return claims, "", nil
+}
+
+// reject writes a failed AuthenticateResponse for credentials rejected for the reason passed.
+func (h *AuthenticationHandler) reject(reason string) {
+	metrics.Authentications.WithLabelValues("failure", reason).Inc()
+	_ = h.mClient.Write(&cloudpacket.AuthenticateResponse{SessionID: h.mClient.SessionID()})
+}
+
+// credentials returns the claims of the proxy from the token passed and/or the client certificate of the proxy,
+// depending on the authentication mode. Proxies authenticated by their certificate alone are given claims holding
+// the tenant and proxy of the certificate.
+func (h *AuthenticationHandler) credentials(token string) (*jwt.Claims, error) {
+	certID, hasCert := h.mClient.CertificateIdentity()
+	if h.mode.RequiresCertificate() && !hasCert {
+		return nil, fmt.Errorf("no verified client certificate presented")
+	}
+	if h.mode == AuthModeCertificate {
+		return &jwt.Claims{Tenant: certID.Tenant, Proxy: certID.Proxy}, nil
+	}
+
+	claims, err := jwt.Validate(token)
+	if err != nil {
+		return nil, err
+	}
+	if h.mode == AuthModeTokenAndCertificate && (claims.Tenant != certID.Tenant || claims.Proxy != certID.Proxy) {
+		return nil, fmt.Errorf("token belongs to tenant %q and proxy %q, but certificate to tenant %q and proxy %q",
+			claims.Tenant, claims.Proxy, certID.Tenant, certID.Proxy)
+	}
+	return claims, nil
+}
+
+// respond writes a successful AuthenticateResponse for the token with the claims passed.
+func (h *AuthenticationHandler) respond(claims *jwt.Claims) error {
+	c := h.mClient
+	if err := c.Write(&cloudpacket.AuthenticateResponse{
+		Success:       true,
+		SessionID:     c.SessionID(),
+		Tenant:        claims.Tenant,
+		MaxBatchSize:  uint32(c.Config().MaxBatchSize),
+		FlushInterval: c.Config().FlushInterval,
+		TokenExpiry:   expiry(claims),
+	}); err != nil {
+		return fmt.Errorf("failed to write authentication response: %v", err)
+	}
+	return nil
 }
 
 func (h *AuthenticationHandler) Close() error {
+	if h.closeStream != nil {
+		h.closeStream()
+	}
 	h.mClient = nil
 	return nil
 }
+
+// leeway returns the clock skew allowed when validating tokens, so that clients are disconnected at the same time
+// their token would no longer be accepted.
+func leeway() time.Duration {
+	cfg, _ := jwt.Current()
+	return cfg.Leeway
+}
+
+// expiry returns the expiry time of the token with the claims passed, or a zero time if it does not expire.
+func expiry(claims *jwt.Claims) (t time.Time) {
+	if claims.ExpiresAt != nil {
+		t = claims.ExpiresAt.Time
+	}
+	return
+}
@@ -0,0 +1,176 @@
+package handler_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/tenant"
+)
+
+// authenticate connects a client with the handshake and authentication handlers registered, completes the
+// handshake and sends an Authenticate packet holding the token passed.
+func authenticate(t *testing.T, revocations *jwt.RevocationStore, tok string) (*client.Client, *proxy) {
+	t.Helper()
+	c, p := connect(t)
+	c.RegisterHandlers(
+		handler.NewHandshakeHandler(c),
+		handler.NewAuthenticationHandler(c, handler.AuthModeToken, revocations, tenant.NewManager(tenant.Policies{})),
+	)
+	writeBatch(t, p, hello())
+	expect[*cloudpacket.ServerHello](t, p)
+	writeBatch(t, p, &cloudpacket.Authenticate{Token: tok})
+	return c, p
+}
+
+// revocationStore configures token validation with the test secret and returns an empty revocation store.
+func revocationStore(t *testing.T) *jwt.RevocationStore {
+	t.Helper()
+	jwt.Configure(jwt.DefaultConfig(jwt.SecretKey(secret)))
+	revocations, err := jwt.NewRevocationStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revocations
+}
+
+func TestAuthenticate(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	c, p := authenticate(t, revocationStore(t), token(t, expiry))
+
+	pk := expect[*cloudpacket.AuthenticateResponse](t, p)
+	if !pk.Success || pk.SessionID != c.SessionID() || pk.Tenant != "network" {
+		t.Errorf("expected successful response for the session, got %+v", pk)
+	}
+	if pk.MaxBatchSize != uint32(c.Config().MaxBatchSize) || pk.FlushInterval != c.Config().FlushInterval {
+		t.Errorf("expected limits of the client in response, got %+v", pk)
+	}
+	if !pk.TokenExpiry.Equal(expiry) {
+		t.Errorf("expected token expiry %v, got %v", expiry, pk.TokenExpiry)
+	}
+	if !c.Authenticated() {
+		t.Error("expected client to be authenticated")
+	}
+}
+
+func TestAuthenticateFailure(t *testing.T) {
+	c, p := authenticate(t, revocationStore(t), "invalid")
+
+	if pk := expect[*cloudpacket.AuthenticateResponse](t, p); pk.Success || pk.SessionID != c.SessionID() {
+		t.Errorf("expected failed response for the session, got %+v", pk)
+	}
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonAuthenticationFailed {
+		t.Errorf("expected disconnect for failed authentication, got %+v", pk)
+	}
+	if c.Authenticated() {
+		t.Error("expected client not to be authenticated")
+	}
+}
+
+func TestAuthenticateRevoked(t *testing.T) {
+	revocations := revocationStore(t)
+	if err := revocations.Revoke(jwt.Revocation{Kind: jwt.RevokeTenant, Value: "network"}); err != nil {
+		t.Fatal(err)
+	}
+	_, p := authenticate(t, revocations, token(t, time.Now().Add(time.Hour)))
+
+	if pk := expect[*cloudpacket.AuthenticateResponse](t, p); pk.Success {
+		t.Errorf("expected failed response for revoked token, got %+v", pk)
+	}
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonAuthenticationFailed {
+		t.Errorf("expected disconnect for failed authentication, got %+v", pk)
+	}
+}
+
+func TestTokenRevoked(t *testing.T) {
+	revocations := revocationStore(t)
+	c, p := authenticate(t, revocations, token(t, time.Now().Add(time.Hour)))
+	expect[*cloudpacket.AuthenticateResponse](t, p)
+
+	// The revocation watcher is registered in a goroutine once the client is authenticated.
+	deadline := time.Now().Add(time.Second)
+	for !slices.ContainsFunc(c.OrderedHandlers(), func(h client.PacketHandler) bool {
+		_, ok := h.(*handler.RevocationWatcher)
+		return ok
+	}) {
+		if time.Now().After(deadline) {
+			t.Fatal("revocation watcher was not registered")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err := revocations.Revoke(jwt.Revocation{Kind: jwt.RevokeProxy, Value: "proxy-1", Reason: "leaked"}); err != nil {
+		t.Fatal(err)
+	}
+	pk := expect[*cloudpacket.Disconnect](t, p)
+	if pk.Reason != cloudpacket.DisconnectReasonTokenRevoked || pk.Message != "token revoked (proxy proxy-1): leaked" {
+		t.Errorf("expected disconnect for revoked token, got %+v", pk)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	revocations := revocationStore(t)
+	cfg := jwt.DefaultConfig(jwt.SecretKey(secret))
+	cfg.Leeway = time.Millisecond * 500
+	jwt.Configure(cfg)
+
+	// Expiry times of tokens are truncated to seconds, so the token expires at most a second from now.
+	expiry := time.Now().Add(time.Second).Truncate(time.Second)
+	c, p := authenticate(t, revocations, token(t, expiry))
+	if pk := expect[*cloudpacket.AuthenticateResponse](t, p); !pk.Success || !pk.TokenExpiry.Equal(expiry) {
+		t.Fatalf("expected successful response with token expiring at %v, got %+v", expiry, pk)
+	}
+
+	// The token is accepted until the leeway has passed, so the client must stay connected until then as well.
+	select {
+	case <-c.Done():
+		t.Fatalf("client closed %v before the token expired", time.Until(expiry))
+	case <-time.After(time.Until(expiry.Add(time.Millisecond * 250))):
+	}
+	if !c.Authenticated() || !c.TokenExpiry().Equal(expiry) {
+		t.Fatalf("expected client to be authenticated with token expiring at %v", expiry)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected client to be closed once the leeway passed")
+	}
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonTokenExpired {
+		t.Errorf("expected disconnect for expired token, got %+v", pk)
+	}
+}
+
+func TestRefreshFailure(t *testing.T) {
+	revocations := revocationStore(t)
+	cfg := jwt.DefaultConfig(jwt.SecretKey(secret))
+	cfg.Leeway = time.Millisecond * 500
+	jwt.Configure(cfg)
+
+	expiry := time.Now().Add(time.Second).Truncate(time.Second)
+	c, p := authenticate(t, revocations, token(t, expiry))
+	if pk := expect[*cloudpacket.AuthenticateResponse](t, p); !pk.Success {
+		t.Fatalf("expected successful response, got %+v", pk)
+	}
+
+	// A rejected refresh must not close the session, as the token it authenticated with is still valid.
+	writeBatch(t, p, &cloudpacket.Authenticate{Token: "invalid"})
+	if pk := expect[*cloudpacket.AuthenticateResponse](t, p); pk.Success || pk.SessionID != c.SessionID() {
+		t.Errorf("expected failed response for the session, got %+v", pk)
+	}
+	if !c.Authenticated() || !c.TokenExpiry().Equal(expiry) {
+		t.Fatalf("expected client to stay authenticated with token expiring at %v", expiry)
+	}
+
+	// The session is closed once the current token expired instead.
+	select {
+	case <-c.Done():
+	case <-time.After(time.Until(expiry.Add(time.Second))):
+		t.Fatal("expected client to be closed once the token expired")
+	}
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonTokenExpired {
+		t.Errorf("expected disconnect for expired token, got %+v", pk)
+	}
+}
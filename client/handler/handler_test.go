@@ -0,0 +1,387 @@
+package handler_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/oomph-ac/ocloud/catalogue"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/internal/pipe"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/recording"
+	"github.com/oomph-ac/ocloud/tenant"
+	"github.com/rs/zerolog"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+var secret = []byte("test-secret")
+
+// writeBatch writes the packets passed to w as a single batch, compressed like a proxy would.
+func writeBatch(t *testing.T, w io.Writer, pks ...packet.Packet) {
+	t.Helper()
+
+	body := bytes.NewBuffer(nil)
+	pw := protocol.NewWriter(body, 0)
+	for _, pk := range pks {
+		id := pk.ID()
+		pw.Uint32(&id)
+		pk.Marshal(pw)
+	}
+
+	compressed := bytes.NewBuffer(nil)
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, cloudpacket.HeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(compressed.Len()))
+	binary.LittleEndian.PutUint64(header[4:12], uint64(len(pks)))
+	if _, err := w.Write(append(header, compressed.Bytes()...)); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+}
+
+// unsignedJWT returns a JWT holding the claims passed, with an empty signature.
+func unsignedJWT(t *testing.T, claims any) []byte {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	return []byte(enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + ".")
+}
+
+// token returns a token of the tenant "network" that expires at the time passed.
+func token(t *testing.T, expiry time.Time) string {
+	t.Helper()
+	s, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, &jwt.Claims{
+		RegisteredClaims: gojwt.RegisteredClaims{ExpiresAt: gojwt.NewNumericDate(expiry)},
+		Tenant:           "network",
+		Proxy:            "proxy-1",
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// hello returns a Hello packet that is accepted by the HandshakeHandler.
+func hello() *cloudpacket.Hello {
+	return &cloudpacket.Hello{
+		ProtocolVersion:   cloudpacket.ProtocolVersion,
+		MinecraftProtocol: protocol.CurrentProtocol,
+		Compression:       []byte{cloudpacket.CompressionZlib},
+		Packets:           []uint32{cloudpacket.IDAuthenticate, cloudpacket.IDPlayerInfo, cloudpacket.IDGamePackets, cloudpacket.IDDetection},
+	}
+}
+
+// proxy is the end of a pipe that the proxy reads from and writes to. The batches written by the server are
+// decoded like a proxy would, and the packets in them are sent to the packets channel.
+type proxy struct {
+	net.Conn
+	packets chan packet.Packet
+}
+
+// readBatches decodes the batches written by the server until the pipe is closed or an invalid batch is read.
+func (p *proxy) readBatches(t *testing.T) {
+	defer close(p.packets)
+	header := make([]byte, cloudpacket.HeaderSize)
+	for {
+		if _, err := io.ReadFull(p, header); err != nil {
+			return
+		}
+		batch := make([]byte, binary.LittleEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(p, batch); err != nil {
+			return
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(batch))
+		if err != nil {
+			t.Errorf("failed to decompress batch: %v", err)
+			return
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("failed to decompress batch: %v", err)
+			return
+		}
+		r := protocol.NewReader(bytes.NewBuffer(data), 0, false)
+		for range binary.LittleEndian.Uint64(header[4:12]) {
+			pk, err := cloudpacket.Decode(r)
+			if err != nil {
+				t.Errorf("failed to decode packet: %v", err)
+				return
+			}
+			p.packets <- pk
+		}
+	}
+}
+
+// expect returns the next packet written by the server, failing the test if it is not of type T or if no packet
+// is written within a second.
+func expect[T packet.Packet](t *testing.T, p *proxy) T {
+	t.Helper()
+	select {
+	case pk, ok := <-p.packets:
+		if !ok {
+			t.Fatalf("expected %T, but the stream was closed", *new(T))
+		}
+		v, ok := pk.(T)
+		if !ok {
+			t.Fatalf("expected %T, got %T", *new(T), pk)
+		}
+		return v
+	case <-time.After(time.Second):
+		t.Fatalf("expected %T, but no packet was written", *new(T))
+	}
+	panic("unreachable")
+}
+
+// connect returns a client reading from one end of a pipe, and the proxy end of the pipe.
+func connect(t *testing.T) (*client.Client, *proxy) {
+	t.Helper()
+	stream, proxyConn := pipe.New()
+	t.Cleanup(func() {
+		_ = proxyConn.Close()
+	})
+	p := &proxy{Conn: proxyConn, packets: make(chan packet.Packet, 64)}
+	go p.readBatches(t)
+
+	cfg := client.DefaultConfig()
+	cfg.FlushInterval = time.Millisecond * 10
+	return client.New(stream, stream.RemoteAddr(), zerolog.Nop(), cfg), p
+}
+
+func TestHandshake(t *testing.T) {
+	c, p := connect(t)
+	c.RegisterHandlers(handler.NewHandshakeHandler(c))
+
+	writeBatch(t, p, hello())
+	pk := expect[*cloudpacket.ServerHello](t, p)
+	if !pk.Accepted || pk.ProtocolVersion != cloudpacket.ProtocolVersion || pk.Compression != cloudpacket.CompressionZlib {
+		t.Errorf("expected proxy to be accepted, got %+v", pk)
+	}
+	if len(pk.Packets) != len(hello().Packets) {
+		t.Errorf("expected all packets advertised to be accepted, got %v", pk.Packets)
+	}
+
+	// Packets written in separate batches must each be decodable on their own.
+	if err := c.Disconnect(cloudpacket.DisconnectReasonKicked, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonKicked || pk.Message != "bye" {
+		t.Errorf("unexpected disconnect %+v", pk)
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	c, p := connect(t)
+	c.RegisterHandlers(handler.NewHandshakeHandler(c))
+
+	pk := hello()
+	pk.ProtocolVersion++
+	writeBatch(t, p, pk)
+	if pk := expect[*cloudpacket.ServerHello](t, p); pk.Accepted || pk.Reason == "" {
+		t.Errorf("expected proxy to be rejected with a reason, got %+v", pk)
+	}
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonIncompatibleProtocol {
+		t.Errorf("expected disconnect for incompatible protocol, got %+v", pk)
+	}
+}
+
+func TestPacketNotNegotiated(t *testing.T) {
+	c, p := connect(t)
+	c.RegisterHandlers(handler.NewHandshakeHandler(c))
+
+	pk := hello()
+	pk.Packets = []uint32{cloudpacket.IDAuthenticate}
+	writeBatch(t, p, pk)
+	if pk := expect[*cloudpacket.ServerHello](t, p); !pk.Accepted || len(pk.Packets) != 1 {
+		t.Fatalf("expected proxy to be accepted with a single packet, got %+v", pk)
+	}
+
+	writeBatch(t, p, &cloudpacket.Detection{Type: "Reach"})
+	if pk := expect[*cloudpacket.Disconnect](t, p); pk.Reason != cloudpacket.DisconnectReasonUnknownPacket {
+		t.Errorf("expected disconnect for packet that was not negotiated, got %+v", pk)
+	}
+}
+
+func TestSessionIsRecorded(t *testing.T) {
+	jwt.Configure(jwt.DefaultConfig(jwt.SecretKey(secret)))
+
+	dir := t.TempDir()
+	sessions, err := catalogue.OpenFile(filepath.Join(dir, "sessions.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sessions.Close()
+	revocations, err := jwt.NewRevocationStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := tenant.NewManager(tenant.Policies{})
+
+	c, p := connect(t)
+	c.RegisterHandlers(
+		handler.NewHandshakeHandler(c),
+		handler.NewAuthenticationHandler(c, handler.AuthModeToken, revocations, tenants),
+		handler.NewPlayerInfoHandler(c),
+		handler.NewOomphRecorder(c, dir, sessions, tenants),
+	)
+
+	writeBatch(t, p, hello())
+	writeBatch(t, p, &cloudpacket.Authenticate{Token: token(t, time.Now().Add(time.Hour))})
+	writeBatch(t, p,
+		&cloudpacket.PlayerInfo{
+			ShieldID:   355,
+			ClientData: unsignedJWT(t, map[string]any{"ThirdPartyName": "Steve", "GameVersion": "1.21.70"}),
+		},
+		&cloudpacket.GamePackets{Packets: []cloudpacket.GamePacket{
+			{Direction: cloudpacket.DirectionServerbound, Tick: 1, PacketID: packet.IDText, Payload: []byte{1, 2, 3}},
+			{Direction: cloudpacket.DirectionClientbound, Tick: 2, PacketID: packet.IDText, Payload: []byte{4, 5}},
+		}},
+		&cloudpacket.Detection{Type: "Reach", SubType: "A", Violations: 1, Tick: 2},
+	)
+
+	// Closing the stream of the proxy closes the client once all batches before it were processed, which
+	// finalizes the recording.
+	_ = p.Close()
+	<-c.Done()
+
+	var session catalogue.Session
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		s, ok := sessions.Session(c.SessionID())
+		if ok && !s.EndTime.IsZero() {
+			session = s
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session was not finalized in the catalogue: %+v", s)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if c.PacketsReceived() != 5 {
+		t.Errorf("expected 5 packets received, got %d", c.PacketsReceived())
+	}
+	if session.Tenant != "network" || session.Proxy != "proxy-1" || session.DisplayName != "Steve" {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if session.Packets != 3 || session.Flags != 1 {
+		t.Errorf("expected 3 packets and 1 flag in catalogue, got %d and %d", session.Packets, session.Flags)
+	}
+
+	f, err := recording.Open(session.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !f.Finalized() {
+		t.Error("recording is not finalized")
+	}
+	if meta := f.Metadata(); meta.ShieldID != 355 || meta.Tenant != "network" || meta.ClientVersion != "1.21.70" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+	if flags := f.Flags(); len(flags) != 1 || flags[0].Type != "Reach" || flags[0].Tick != 2 {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+
+	// The Hello and Authenticate packets are cancelled by their handlers, so they must not be recorded.
+	var ids []uint32
+	for _, entry := range f.Index() {
+		entries, err := f.ReadChunk(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			pk, err := cloudpacket.Decode(protocol.NewReader(bytes.NewBuffer(e.Payload), 355, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, pk.ID())
+			if games, ok := pk.(*cloudpacket.GamePackets); ok && (len(games.Packets) != 2 || !bytes.Equal(games.Packets[1].Payload, []byte{4, 5})) {
+				t.Errorf("unexpected game packets %+v", games.Packets)
+			}
+		}
+	}
+	expected := []uint32{cloudpacket.IDPlayerInfo, cloudpacket.IDGamePackets, cloudpacket.IDDetection}
+	if len(ids) != len(expected) {
+		t.Fatalf("expected packets %v to be recorded, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatalf("expected packets %v to be recorded, got %v", expected, ids)
+		}
+	}
+}
+
+func TestIdleSessionIsFlushed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the recording to be flushed")
+	}
+	jwt.Configure(jwt.DefaultConfig(jwt.SecretKey(secret)))
+
+	dir := t.TempDir()
+	sessions, err := catalogue.OpenFile(filepath.Join(dir, "sessions.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sessions.Close()
+	revocations, err := jwt.NewRevocationStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := tenant.NewManager(tenant.Policies{})
+
+	c, p := connect(t)
+	c.RegisterHandlers(
+		handler.NewHandshakeHandler(c),
+		handler.NewAuthenticationHandler(c, handler.AuthModeToken, revocations, tenants),
+		handler.NewPlayerInfoHandler(c),
+		handler.NewOomphRecorder(c, dir, sessions, tenants),
+	)
+	defer c.Close(nil)
+
+	writeBatch(t, p, hello())
+	writeBatch(t, p, &cloudpacket.Authenticate{Token: token(t, time.Now().Add(time.Hour))})
+	writeBatch(t, p, &cloudpacket.PlayerInfo{ShieldID: 355, ClientData: unsignedJWT(t, map[string]any{})})
+
+	// No further packets are sent, so the chunk holding the PlayerInfo packet is only written by the flush timer.
+	time.Sleep(recording.MaxChunkDuration + time.Millisecond*500)
+	session, ok := sessions.Session(c.SessionID())
+	if !ok {
+		t.Fatal("session was not added to the catalogue")
+	}
+	f, err := recording.Open(session.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Finalized() {
+		t.Error("expected recording of a connected session not to be finalized")
+	}
+	if index := f.Index(); len(index) != 1 || index[0].Packets != 1 {
+		t.Errorf("expected a single chunk holding the PlayerInfo packet, got %+v", index)
+	}
+	select {
+	case <-c.Done():
+		t.Error("expected client to stay connected")
+	default:
+	}
+}
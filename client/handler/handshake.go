@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/context"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// supportedCompression is the list of compression algorithms supported by the server.
+var supportedCompression = []byte{cloudpacket.CompressionZlib}
+
+// HandshakeHandler is a packet handler that negotiates the protocol used with the proxy. The proxy must send a
+// Hello packet before any other packet, which is answered with a ServerHello.
+type HandshakeHandler struct {
+	mClient *client.Client
+	id      uuid.UUID
+}
+
+func NewHandshakeHandler(c *client.Client) *HandshakeHandler {
+	return &HandshakeHandler{mClient: c}
+}
+
+func (h *HandshakeHandler) SetID(id uuid.UUID) {
+	h.id = id
+}
+
+func (h *HandshakeHandler) Recieve(ctx *context.PacketContext) {
+	c := h.mClient
+	if _, ok := c.Protocol(); ok {
+		return
+	}
+
+	pk, ok := ctx.Packet().(*cloudpacket.Hello)
+	if !ok {
+		ctx.SetError(fmt.Errorf("expected hello packet, got %T", ctx.Packet()))
+		return
+	}
+	// The Hello packet is only relevant to this handler.
+	ctx.Cancel()
+
+	proto, err := negotiate(pk)
+	if err != nil {
+		// The ServerHello is flushed along with the Disconnect packet when the client is closed.
+		_ = c.Write(&cloudpacket.ServerHello{
+			Reason:          err.Error(),
+			ProtocolVersion: cloudpacket.ProtocolVersion,
+		})
+		ctx.SetError(client.DisconnectErrorf(cloudpacket.DisconnectReasonIncompatibleProtocol, "handshake rejected: %v", err))
+		return
+	}
+
+	if err := c.Write(&cloudpacket.ServerHello{
+		Accepted:        true,
+		ProtocolVersion: cloudpacket.ProtocolVersion,
+		Compression:     proto.Compression,
+		Packets:         proto.Packets,
+	}); err != nil {
+		ctx.SetError(fmt.Errorf("failed to write server hello: %v", err))
+		return
+	}
+
+	// Now that the handshake is completed, we can remove this handler from the client. We use a goroutine to
+	// unregister the handler to avoid a deadlock.
+	go c.UnregisterHandler(h.id)
+	c.SetProtocol(proto)
+}
+
+func (h *HandshakeHandler) Close() error {
+	h.mClient = nil
+	return nil
+}
+
+// negotiate chooses the protocol used with the proxy based on the Hello packet it sent. An error describing why
+// the proxy is rejected is returned if the proxy is incompatible with the server.
+func negotiate(pk *cloudpacket.Hello) (client.Protocol, error) {
+	proto := client.Protocol{
+		Version:           pk.ProtocolVersion,
+		MinecraftProtocol: pk.MinecraftProtocol,
+	}
+	if pk.ProtocolVersion != cloudpacket.ProtocolVersion {
+		return proto, fmt.Errorf("unsupported oCloud protocol version %d (server supports %d)", pk.ProtocolVersion, cloudpacket.ProtocolVersion)
+	}
+	if pk.MinecraftProtocol != protocol.CurrentProtocol {
+		return proto, fmt.Errorf("unsupported Minecraft protocol version %d (server supports %d)", pk.MinecraftProtocol, protocol.CurrentProtocol)
+	}
+
+	i := slices.IndexFunc(pk.Compression, func(algorithm byte) bool {
+		return slices.Contains(supportedCompression, algorithm)
+	})
+	if i == -1 {
+		return proto, fmt.Errorf("no supported compression algorithm in %v (server supports %v)", pk.Compression, supportedCompression)
+	}
+	proto.Compression = pk.Compression[i]
+
+	for _, id := range pk.Packets {
+		if cloudpacket.Registered(id) {
+			proto.Packets = append(proto.Packets, id)
+		}
+	}
+	return proto, nil
+}
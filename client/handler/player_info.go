@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/context"
+	"github.com/oomph-ac/ocloud/client/identity"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+)
+
+// PlayerInfoHandler is a packet handler that handles the PlayerInfo packet sent by the proxy, which describes
+// the player the session belongs to.
+type PlayerInfoHandler struct {
+	mClient *client.Client
+	id      uuid.UUID
+}
+
+func NewPlayerInfoHandler(c *client.Client) *PlayerInfoHandler {
+	return &PlayerInfoHandler{mClient: c}
+}
+
+func (h *PlayerInfoHandler) SetID(id uuid.UUID) {
+	h.id = id
+}
+
+func (h *PlayerInfoHandler) Recieve(ctx *context.PacketContext) {
+	pk, ok := ctx.Packet().(*cloudpacket.PlayerInfo)
+	if !ok {
+		return
+	}
+
+	id, err := identity.Parse(pk.IdentityData, pk.ClientData)
+	if err != nil {
+		ctx.SetError(fmt.Errorf("invalid player info: %v", err))
+		return
+	}
+
+	// The shield ID is required to decode any items sent by the proxy afterwards, so the protocol reader and
+	// writer of the client must be updated before any other packets are read.
+	c := h.mClient
+	c.SetShieldID(pk.ShieldID)
+	c.SetIdentity(id)
+}
+
+func (h *PlayerInfoHandler) Close() error {
+	h.mClient = nil
+	return nil
+}
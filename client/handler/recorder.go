@@ -1,24 +1,56 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/catalogue"
 	"github.com/oomph-ac/ocloud/client"
 	"github.com/oomph-ac/ocloud/client/context"
+	"github.com/oomph-ac/ocloud/metrics"
 	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/recording"
+	"github.com/oomph-ac/ocloud/tenant"
 )
 
+// RecordingExtension is the file extension used for recordings written by the OomphRecorder.
+const RecordingExtension = ".ocr"
+
 // OomphRecorder is a packet handler that records packets related to Oomph events.
 // This allows for player sessions to be recorded and replayed in the future for
 // potential debug or general analysis purposes.
 type OomphRecorder struct {
 	mClient *client.Client
 	id      uuid.UUID
+
+	// dir is the directory that recordings are stored in.
+	dir string
+	// cat is the catalogue that the session is added to once the recording is created. It is limited to the
+	// tenant of the client once the client is authenticated.
+	cat catalogue.Catalogue
+	// tenants is the manager enforcing the storage quota and maximum session length of the client's tenant.
+	tenants *tenant.Manager
+
+	// rec is the recording of the client's session. It is created once the first packet after
+	// authentication is received.
+	rec *recording.Writer
+	// session is the catalogue entry of the recording.
+	session catalogue.Session
+	// accounted is the size of the recording that was already added to the storage used by the tenant.
+	accounted int64
+	// flushTimer periodically writes the chunk currently being recorded to disk, so that packets of an idle
+	// session are not only held in memory.
+	flushTimer *time.Timer
+	mu         sync.Mutex
 }
 
-func NewOomphRecorder(c *client.Client) *OomphRecorder {
-	return &OomphRecorder{mClient: c}
+func NewOomphRecorder(c *client.Client, dir string, cat catalogue.Catalogue, tenants *tenant.Manager) *OomphRecorder {
+	return &OomphRecorder{mClient: c, dir: dir, cat: cat, tenants: tenants}
 }
 
 func (r *OomphRecorder) SetID(id uuid.UUID) {
@@ -31,14 +63,182 @@ func (r *OomphRecorder) Recieve(ctx *context.PacketContext) {
 		return
 	}
 
-	// TODO: Implementation of recording player/Oomph events.
-	switch pk := ctx.Packet().(type) {
-	case *cloudpacket.Authenticate:
-		fmt.Println(pk)
+	// Game packets can only be decoded using the shield ID of the player, so the proxy must send the PlayerInfo
+	// packet before forwarding any game packets.
+	if _, ok := ctx.Packet().(*cloudpacket.GamePackets); ok {
+		if _, ok := r.mClient.Identity(); !ok {
+			ctx.SetError(fmt.Errorf("game packets received before player info"))
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rec == nil {
+		if err := r.createRecording(); err != nil {
+			ctx.SetError(&client.DisconnectError{Reason: cloudpacket.DisconnectReasonInternalError, Err: err})
+			return
+		}
+	}
+	if pk, ok := ctx.Packet().(*cloudpacket.PlayerInfo); ok {
+		if err := r.updatePlayer(pk); err != nil {
+			ctx.SetError(client.DisconnectErrorf(cloudpacket.DisconnectReasonInternalError, "failed to record player info: %v", err))
+			return
+		}
+	}
+	now := time.Now()
+	if err := r.rec.WritePacket(now, ctx.Packet()); err != nil {
+		ctx.SetError(client.DisconnectErrorf(cloudpacket.DisconnectReasonInternalError, "failed to record packet: %v", err))
+		return
+	}
+	if pk, ok := ctx.Packet().(*cloudpacket.Detection); ok {
+		if err := r.rec.WriteFlag(now, recording.Flag{
+			Tick:       pk.Tick,
+			Type:       pk.Type,
+			SubType:    pk.SubType,
+			Violations: pk.Violations,
+		}); err != nil {
+			ctx.SetError(client.DisconnectErrorf(cloudpacket.DisconnectReasonInternalError, "failed to record flag: %v", err))
+			return
+		}
+	}
+	if err := r.enforcePolicy(now); err != nil {
+		ctx.SetError(&client.DisconnectError{Reason: cloudpacket.DisconnectReasonQuotaExceeded, Err: err})
+	}
+}
+
+// enforcePolicy adds the data recorded since the last call to the storage used by the tenant, and returns an
+// error if the tenant exceeded its storage quota or the session exceeded the maximum session length.
+func (r *OomphRecorder) enforcePolicy(now time.Time) error {
+	tenantID := r.session.Tenant
+	size := r.rec.Size()
+	metrics.RecordingBytes.WithLabelValues(tenantID).Add(float64(size - r.accounted))
+	err := r.tenants.AddBytes(tenantID, size-r.accounted)
+	r.accounted = size
+	if err != nil {
+		return err
+	}
+
+	if maxLength := time.Duration(r.tenants.Policy(tenantID).MaxSessionLength); maxLength > 0 && now.Sub(r.session.StartTime) > maxLength {
+		return fmt.Errorf("session exceeded the maximum session length of %v of tenant %s", maxLength, tenantID)
+	}
+	return nil
+}
+
+// createRecording creates the recording for the client's session in the directory of its tenant, and adds it to
+// the catalogue.
+func (r *OomphRecorder) createRecording() error {
+	c := r.mClient
+	claims := c.Claims()
+	dir := filepath.Join(r.dir, claims.Tenant)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create tenant recording directory: %v", err)
+	}
+
+	proto, _ := c.Protocol()
+	path := filepath.Join(dir, c.SessionID().String()+RecordingExtension)
+	rec, err := recording.Create(path, recording.Header{
+		SessionID:       c.SessionID(),
+		StartTime:       time.Now(),
+		RemoteAddr:      c.Addr().String(),
+		ProtocolVersion: proto.MinecraftProtocol,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.rec = rec
+	r.flushTimer = time.AfterFunc(recording.MaxChunkDuration, r.flush)
+	if err := rec.SetMetadata(recording.Metadata{Tenant: claims.Tenant, Proxy: claims.Proxy}); err != nil {
+		return err
+	}
+
+	r.cat = catalogue.ForTenant(r.cat, claims.Tenant)
+	r.session = catalogue.Session{
+		ID:         c.SessionID(),
+		Tenant:     claims.Tenant,
+		Proxy:      claims.Proxy,
+		RemoteAddr: c.Addr().String(),
+		StartTime:  rec.Header().StartTime,
+		Path:       path,
+	}
+	return r.updateCatalogue()
+}
+
+// flush writes the chunk currently being recorded to disk and enforces the policy of the tenant, disconnecting
+// the client if either fails. It is called every MaxChunkDuration until the recorder is closed.
+func (r *OomphRecorder) flush() {
+	r.mu.Lock()
+	c := r.mClient
+	if c == nil {
+		r.mu.Unlock()
+		return
+	}
+	var err error
+	if flushErr := r.rec.Flush(); flushErr != nil {
+		err = client.DisconnectErrorf(cloudpacket.DisconnectReasonInternalError, "failed to flush recording: %v", flushErr)
+	} else if policyErr := r.enforcePolicy(time.Now()); policyErr != nil {
+		err = &client.DisconnectError{Reason: cloudpacket.DisconnectReasonQuotaExceeded, Err: policyErr}
+	} else {
+		r.flushTimer.Reset(recording.MaxChunkDuration)
+	}
+	r.mu.Unlock()
+
+	// Closing the client closes the recorder, so it must be closed after the lock is released.
+	if err != nil {
+		_ = c.Close(err)
 	}
 }
 
+// updatePlayer writes the recording metadata for the player described by the PlayerInfo packet passed, and
+// updates the catalogue entry of the session accordingly. The PlayerInfoHandler is registered before the
+// recorder, so the identity of the client is already set.
+func (r *OomphRecorder) updatePlayer(pk *cloudpacket.PlayerInfo) error {
+	meta := r.rec.Metadata()
+	meta.ShieldID = pk.ShieldID
+	if id, ok := r.mClient.Identity(); ok {
+		meta.XUID = id.XUID
+		meta.PlayerUUID = id.UUID
+		meta.DisplayName = id.DisplayName
+		meta.DeviceOS = int32(id.DeviceOS)
+		meta.ClientVersion = id.ClientVersion
+	}
+	if err := r.rec.SetMetadata(meta); err != nil {
+		return err
+	}
+
+	r.session.XUID = meta.XUID
+	r.session.DisplayName = meta.DisplayName
+	return r.updateCatalogue()
+}
+
+// updateCatalogue puts the latest state of the session into the catalogue.
+func (r *OomphRecorder) updateCatalogue() error {
+	r.session.Packets = r.rec.Packets()
+	r.session.Flags = r.rec.Flags()
+	r.session.Size = r.rec.Size()
+	if err := r.cat.Put(r.session); err != nil {
+		return fmt.Errorf("failed to update catalogue: %v", err)
+	}
+	return nil
+}
+
 func (r *OomphRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.mClient = nil
-	return nil
+	if r.rec == nil {
+		return nil
+	}
+	r.flushTimer.Stop()
+
+	closeErr := r.rec.Close()
+	r.session.EndTime = time.Now()
+	// Closing the recording writes its index, so the final size must be accounted for as well.
+	metrics.RecordingBytes.WithLabelValues(r.session.Tenant).Add(float64(r.rec.Size() - r.accounted))
+	_ = r.tenants.AddBytes(r.session.Tenant, r.rec.Size()-r.accounted)
+	r.accounted = r.rec.Size()
+	return errors.Join(closeErr, r.updateCatalogue())
 }
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/context"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+)
+
+// RevocationWatcher is a packet handler that disconnects an authenticated client as soon as the token it
+// authenticated with is revoked. It does not handle any packets itself.
+type RevocationWatcher struct {
+	mClient *client.Client
+	id      uuid.UUID
+
+	unsubscribe func()
+}
+
+func NewRevocationWatcher(c *client.Client, revocations *jwt.RevocationStore) *RevocationWatcher {
+	w := &RevocationWatcher{mClient: c}
+	// The claims are loaded from the client every time, as the proxy may re-authenticate with a new token.
+	w.unsubscribe = revocations.Subscribe(func(r jwt.Revocation) {
+		if r.Matches(c.Claims()) {
+			w.disconnect(c, r)
+		}
+	})
+
+	// The token may have been revoked between the client authenticating and the watcher subscribing.
+	if r, ok := revocations.Revoked(c.Claims()); ok {
+		w.disconnect(c, r)
+	}
+	return w
+}
+
+func (w *RevocationWatcher) SetID(id uuid.UUID) {
+	w.id = id
+}
+
+func (w *RevocationWatcher) Recieve(*context.PacketContext) {}
+
+// disconnect disconnects the client because of the revocation passed. The client is closed in a goroutine, as
+// closing the client closes the watcher, which unsubscribes from the revocation store.
+func (w *RevocationWatcher) disconnect(c *client.Client, r jwt.Revocation) {
+	msg := fmt.Sprintf("token revoked (%s %s)", r.Kind, r.Value)
+	if r.Reason != "" {
+		msg += ": " + r.Reason
+	}
+	go c.Disconnect(cloudpacket.DisconnectReasonTokenRevoked, msg)
+}
+
+func (w *RevocationWatcher) Close() error {
+	w.unsubscribe()
+	w.mClient = nil
+	return nil
+}
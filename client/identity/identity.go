@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+)
+
+// Identity holds the information about a player that is relevant to a session, parsed from the identity and
+// client data forwarded by a proxy.
+type Identity struct {
+	// XUID is the XBOX Live user ID of the player. It is empty if the player is not authenticated with XBOX Live.
+	XUID string
+	// UUID is the identity UUID of the player.
+	UUID string
+	// DisplayName is the gamertag of the player.
+	DisplayName string
+	// DeviceOS is the operating system of the device the player is playing on.
+	DeviceOS protocol.DeviceOS
+	// ClientVersion is the version of the game the player is playing on, such as "1.21.70".
+	ClientVersion string
+}
+
+// Parse parses the identity data and client data passed into an Identity. The identity data is expected to be
+// either a JWT chain (a JSON object holding a list of JWTs under "chain") or a single JWT, and may be empty if the
+// player is not authenticated with XBOX Live. The client data is expected to be a single JWT. The signatures of the
+// JWTs are not verified, as the proxy is responsible for verifying the login of the player.
+func Parse(identityData, clientData []byte) (Identity, error) {
+	var (
+		id         Identity
+		clientInfo login.ClientData
+	)
+	if err := decodeClaims(string(clientData), &clientInfo); err != nil {
+		return id, fmt.Errorf("failed to parse client data: %v", err)
+	}
+	id.DeviceOS = clientInfo.DeviceOS
+	id.ClientVersion = clientInfo.GameVersion
+	id.DisplayName = clientInfo.ThirdPartyName
+
+	if len(identityData) == 0 {
+		return id, nil
+	}
+	identityInfo, err := parseIdentityData(identityData)
+	if err != nil {
+		return id, fmt.Errorf("failed to parse identity data: %v", err)
+	}
+	id.XUID = identityInfo.XUID
+	id.UUID = identityInfo.Identity
+	if identityInfo.DisplayName != "" {
+		id.DisplayName = identityInfo.DisplayName
+	}
+	return id, nil
+}
+
+// parseIdentityData parses the identity data of a player from a JWT chain or a single JWT. The identity data is
+// held in the "extraData" claim of the last JWT in the chain that holds it.
+func parseIdentityData(data []byte) (login.IdentityData, error) {
+	var (
+		chain struct {
+			Chain []string `json:"chain"`
+		}
+		identityData login.IdentityData
+	)
+	if err := json.Unmarshal(data, &chain); err != nil {
+		chain.Chain = []string{string(data)}
+	}
+	if len(chain.Chain) == 0 {
+		return identityData, fmt.Errorf("identity chain is empty")
+	}
+
+	found := false
+	for _, token := range chain.Chain {
+		var claims struct {
+			ExtraData *login.IdentityData `json:"extraData"`
+		}
+		if err := decodeClaims(token, &claims); err != nil {
+			return identityData, err
+		}
+		if claims.ExtraData != nil {
+			identityData, found = *claims.ExtraData, true
+		}
+	}
+	if !found {
+		return identityData, fmt.Errorf("identity chain holds no identity data")
+	}
+	return identityData, nil
+}
+
+// decodeClaims decodes the claims of the JWT passed into v, without verifying its signature.
+func decodeClaims(token string, v any) error {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT: expected 3 segments, got %d", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fmt.Errorf("malformed JWT payload: %v", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("malformed JWT claims: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package jwt
+
+import (
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims holds the claims of a token issued by the Oomph API to a proxy.
+type Claims struct {
+	jwt.RegisteredClaims
+	// Tenant is the ID of the network the proxy belongs to.
+	Tenant string `json:"tenant"`
+	// Proxy is the ID of the proxy the token was issued to.
+	Proxy string `json:"proxy"`
+	// Scopes is the list of scopes granted to the proxy.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// HasScope returns true if the scope passed was granted to the proxy.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
@@ -1,17 +1,53 @@
 package jwt
 
 import (
-	"fmt"
-	"os"
+	"sync/atomic"
+	"time"
 )
 
-var jwtSecret []byte
+// Config holds the rules that tokens are validated against.
+type Config struct {
+	// Keys provides the keys used to verify the signature of tokens.
+	Keys KeyProvider
+	// Issuer is the required "iss" claim of tokens. If empty, the issuer is not checked.
+	Issuer string
+	// Audience is the required "aud" claim of tokens. If empty, the audience is not checked.
+	Audience string
+	// Algorithms is the list of signing algorithms accepted. Tokens signed with any other algorithm are
+	// rejected, regardless of the algorithm claimed in their header.
+	Algorithms []string
+	// Leeway is the clock skew allowed when checking the "exp", "nbf" and "iat" claims.
+	Leeway time.Duration
+	// RequireExpiry rejects tokens that have no "exp" claim.
+	RequireExpiry bool
+}
+
+// DefaultConfig returns the default validation rules, using the keys passed.
+func DefaultConfig(keys KeyProvider) Config {
+	algorithms := []string{"RS256", "ES256", "EdDSA"}
+	if _, ok := keys.(SecretKey); ok {
+		algorithms = []string{"HS256"}
+	}
+	return Config{
+		Keys:          keys,
+		Algorithms:    algorithms,
+		Leeway:        time.Second * 30,
+		RequireExpiry: true,
+	}
+}
+
+var config atomic.Pointer[Config]
+
+// Configure replaces the rules that tokens are validated against.
+func Configure(cfg Config) {
+	config.Store(&cfg)
+}
 
-func init() {
-	if secret := os.Getenv("JWT_SECRET"); secret != "" {
-		jwtSecret = []byte(secret)
-	} else {
-		fmt.Println("JWT_SECRET environment variable not set")
-		os.Exit(1)
+// Current returns the rules that tokens are currently validated against. False is returned if Configure was
+// never called, in which case no token can be validated.
+func Current() (Config, bool) {
+	if cfg := config.Load(); cfg != nil {
+		return *cfg, true
 	}
+	return Config{}, false
 }
@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/rs/zerolog"
+)
+
+// KeyProvider provides the keys used to verify the signature of tokens.
+type KeyProvider interface {
+	// Key returns the key used to verify a token signed with the algorithm passed. The key ID is the "kid" header
+	// of the token, and may be empty.
+	Key(alg, kid string) (any, error)
+}
+
+// SecretKey is a KeyProvider that provides a single HMAC secret for every token.
+type SecretKey []byte
+
+func (s SecretKey) Key(alg, _ string) (any, error) {
+	if !strings.HasPrefix(alg, "HS") {
+		return nil, fmt.Errorf("secret key cannot verify tokens signed with %s", alg)
+	}
+	return []byte(s), nil
+}
+
+const (
+	// DefaultJWKSRefresh is the default interval at which a JWKS is reloaded.
+	DefaultJWKSRefresh = time.Minute * 5
+	// DefaultJWKSGrace is the default duration that keys removed from a JWKS are still accepted for, so that
+	// tokens signed shortly before a key rotation remain valid.
+	DefaultJWKSGrace = time.Hour
+	// minJWKSRefresh is the minimum time between two reloads triggered by a token with an unknown key ID.
+	minJWKSRefresh = time.Second * 30
+)
+
+// jwk is a key loaded from a JWKS.
+type jwk struct {
+	key any
+	alg string
+	// removedAt is the time at which the key was no longer present in the JWKS. It is zero if the key is
+	// still present.
+	removedAt time.Time
+}
+
+// JWKSProvider is a KeyProvider that loads keys from a JSON Web Key Set, stored either on disk or at an HTTP(S)
+// URL. The JWKS is reloaded periodically, and keys removed from it are kept for a grace period to allow keys to
+// be rotated without rejecting tokens signed with the previous key.
+type JWKSProvider struct {
+	source string
+	grace  time.Duration
+	client *http.Client
+	log    zerolog.Logger
+
+	keys        map[string]*jwk
+	lastRefresh time.Time
+	mu          sync.RWMutex
+	refreshMu   sync.Mutex
+
+	close     chan struct{}
+	onceClose sync.Once
+}
+
+// NewJWKSProvider loads the JWKS from the source passed, which is either a file path or an HTTP(S) URL, and
+// starts reloading it at the refresh interval passed. Failed reloads are logged to the logger passed. An error is
+// returned if the JWKS could not be loaded.
+func NewJWKSProvider(source string, refresh, grace time.Duration, log zerolog.Logger) (*JWKSProvider, error) {
+	p := &JWKSProvider{
+		source: source,
+		grace:  grace,
+		client: &http.Client{Timeout: time.Second * 10},
+		log:    log,
+		keys:   make(map[string]*jwk),
+		close:  make(chan struct{}),
+	}
+	if err := p.Refresh(); err != nil {
+		return nil, err
+	}
+	go p.refreshLoop(refresh)
+	return p, nil
+}
+
+func (p *JWKSProvider) Key(alg, kid string) (any, error) {
+	key, err := p.lookup(alg, kid)
+	if err == nil {
+		return key, nil
+	}
+
+	// The key may have been added to the JWKS since it was last loaded, so we reload it once and try again,
+	// unless it was reloaded very recently.
+	p.mu.RLock()
+	recent := time.Since(p.lastRefresh) < minJWKSRefresh
+	p.mu.RUnlock()
+	if recent || kid == "" {
+		return nil, err
+	}
+	if refreshErr := p.Refresh(); refreshErr != nil {
+		return nil, fmt.Errorf("%v (reload failed: %v)", err, refreshErr)
+	}
+	return p.lookup(alg, kid)
+}
+
+// Refresh reloads the JWKS from its source. Keys no longer present are kept until their grace period has passed.
+func (p *JWKSProvider) Refresh() error {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	data, err := p.load()
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS from %s: %v", p.source, err)
+	}
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS from %s: %v", p.source, err)
+	}
+	if len(set.Keys) == 0 {
+		return fmt.Errorf("JWKS from %s holds no keys", p.source)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	present := make(map[string]struct{}, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		present[key.KeyID] = struct{}{}
+		p.keys[key.KeyID] = &jwk{key: key.Key, alg: key.Algorithm}
+	}
+	for kid, key := range p.keys {
+		if _, ok := present[kid]; ok {
+			continue
+		}
+		if key.removedAt.IsZero() {
+			key.removedAt = now
+		} else if now.Sub(key.removedAt) > p.grace {
+			delete(p.keys, kid)
+		}
+	}
+	p.lastRefresh = now
+	return nil
+}
+
+// Close stops the JWKS from being reloaded.
+func (p *JWKSProvider) Close() {
+	p.onceClose.Do(func() {
+		close(p.close)
+	})
+}
+
+// lookup returns the key with the ID passed, if it exists, may be used with the algorithm passed and its grace
+// period has not passed. If the key ID is empty, the JWKS must hold exactly one key.
+func (p *JWKSProvider) lookup(alg, kid string) (any, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keys[kid]
+	if kid == "" && !ok {
+		if len(p.keys) != 1 {
+			return nil, fmt.Errorf("token has no key ID and JWKS holds %d keys", len(p.keys))
+		}
+		for _, k := range p.keys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if !key.removedAt.IsZero() && time.Since(key.removedAt) > p.grace {
+		return nil, fmt.Errorf("key %q has been rotated out", kid)
+	}
+	if key.alg != "" && key.alg != alg {
+		return nil, fmt.Errorf("key %q cannot verify tokens signed with %s", kid, alg)
+	}
+	return key.key, nil
+}
+
+// load reads the raw JWKS from its source.
+func (p *JWKSProvider) load() ([]byte, error) {
+	if !strings.HasPrefix(p.source, "http://") && !strings.HasPrefix(p.source, "https://") {
+		return os.ReadFile(p.source)
+	}
+
+	resp, err := p.client.Get(p.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+}
+
+// refreshLoop reloads the JWKS at the interval passed until the provider is closed. Failed reloads keep the
+// previously loaded keys.
+func (p *JWKSProvider) refreshLoop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.close:
+			return
+		case <-t.C:
+			if err := p.Refresh(); err != nil {
+				p.log.Error().Err(err).Str("source", p.source).Msg("failed to reload JWKS")
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// RevokeToken revokes a single token by its "jti" claim.
+	RevokeToken = "token"
+	// RevokeProxy revokes all tokens issued to a proxy.
+	RevokeProxy = "proxy"
+	// RevokeTenant revokes all tokens issued to the proxies of a tenant.
+	RevokeTenant = "tenant"
+)
+
+// Revocation is an entry in a RevocationStore, revoking one or more tokens.
+type Revocation struct {
+	// Kind is the kind of revocation, which is one of RevokeToken, RevokeProxy or RevokeTenant.
+	Kind string `json:"kind"`
+	// Value is the token ID, proxy ID or tenant ID that is revoked.
+	Value string `json:"value"`
+	// Reason is the reason the tokens were revoked.
+	Reason string `json:"reason,omitempty"`
+	// Time is the time at which the tokens were revoked.
+	Time time.Time `json:"time"`
+}
+
+// Matches returns true if the revocation revokes the token with the claims passed.
+func (r Revocation) Matches(claims *Claims) bool {
+	switch r.Kind {
+	case RevokeToken:
+		return claims.ID != "" && claims.ID == r.Value
+	case RevokeProxy:
+		return claims.Proxy != "" && claims.Proxy == r.Value
+	case RevokeTenant:
+		return claims.Tenant != "" && claims.Tenant == r.Value
+	}
+	return false
+}
+
+// Validate returns an error if the revocation has an unknown kind or no value.
+func (r Revocation) Validate() error {
+	switch r.Kind {
+	case RevokeToken, RevokeProxy, RevokeTenant:
+	default:
+		return fmt.Errorf("unknown revocation kind %q", r.Kind)
+	}
+	if r.Value == "" {
+		return fmt.Errorf("revocation has no value")
+	}
+	return nil
+}
+
+// key returns the key the revocation is stored under.
+func (r Revocation) key() string {
+	return r.Kind + ":" + r.Value
+}
+
+// RevocationStore holds all revoked tokens, optionally persisted to a file. Functions may subscribe to the store
+// to be notified of new revocations, so that sessions using a revoked token can be closed immediately.
+type RevocationStore struct {
+	path string
+
+	revocations map[string]Revocation
+	subscribers map[int]func(Revocation)
+	nextID      int
+	mu          sync.RWMutex
+}
+
+// NewRevocationStore returns a RevocationStore persisted to the file at the path passed, loading any revocations
+// already stored in it. If the path is empty, revocations are only kept in memory.
+func NewRevocationStore(path string) (*RevocationStore, error) {
+	s := &RevocationStore{
+		path:        path,
+		revocations: make(map[string]Revocation),
+		subscribers: make(map[int]func(Revocation)),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Revoke adds the revocation passed to the store, persists it and notifies all subscribers. If persisting the
+// revocation fails, an error is returned, but the revocation is still applied until the server restarts.
+func (s *RevocationStore) Revoke(r Revocation) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	s.revocations[r.key()] = r
+	err := s.save()
+	s.mu.Unlock()
+
+	s.notify([]Revocation{r})
+	return err
+}
+
+// Revoked checks if the token with the claims passed was revoked, returning the revocation if so.
+func (s *RevocationStore) Revoked(claims *Claims) (Revocation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range []string{RevokeToken + ":" + claims.ID, RevokeProxy + ":" + claims.Proxy, RevokeTenant + ":" + claims.Tenant} {
+		if r, ok := s.revocations[key]; ok && r.Matches(claims) {
+			return r, true
+		}
+	}
+	return Revocation{}, false
+}
+
+// Subscribe calls the function passed for every revocation added to the store from now on. The function returned
+// removes the subscription.
+func (s *RevocationStore) Subscribe(f func(Revocation)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.subscribers[id] = f
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// Reload re-reads the revocations from the file of the store, notifying subscribers of any revocations that were
+// added to the file since it was last read. Revocations in the file are merged into the store: revocations that
+// are missing from the file, for example because persisting them failed, are kept until the server restarts.
+func (s *RevocationStore) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	// The lock is held while reading the file, so that a revocation persisted by Revoke in the meantime cannot be
+	// missed.
+	s.mu.Lock()
+	added, err := s.load()
+	s.mu.Unlock()
+
+	s.notify(added)
+	return err
+}
+
+// load reads the revocations from the file of the store and adds those not yet in the store, returning them. The
+// lock of the store must be held.
+func (s *RevocationStore) load() ([]Revocation, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read revocations: %v", err)
+	}
+	var list []Revocation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse revocations: %v", err)
+	}
+
+	var added []Revocation
+	for _, r := range list {
+		if _, ok := s.revocations[r.key()]; !ok {
+			added = append(added, r)
+		}
+		s.revocations[r.key()] = r
+	}
+	return added, nil
+}
+
+// notify calls all subscribers with the revocations passed. It must not be called while holding the lock of the
+// store, as subscribers may unsubscribe while being notified.
+func (s *RevocationStore) notify(revocations []Revocation) {
+	if len(revocations) == 0 {
+		return
+	}
+	s.mu.RLock()
+	subscribers := make([]func(Revocation), 0, len(s.subscribers))
+	for _, f := range s.subscribers {
+		subscribers = append(subscribers, f)
+	}
+	s.mu.RUnlock()
+
+	for _, r := range revocations {
+		for _, f := range subscribers {
+			f(r)
+		}
+	}
+}
+
+// save writes all revocations to the file of the store. The lock of the store must be held.
+func (s *RevocationStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]Revocation, 0, len(s.revocations))
+	for _, r := range s.revocations {
+		list = append(list, r)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode revocations: %v", err)
+	}
+	if err := os.WriteFile(s.path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write revocations: %v", err)
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
@@ -0,0 +1,68 @@
+package jwt_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oomph-ac/ocloud/client/jwt"
+)
+
+func TestRevocationReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	s, err := jwt.NewRevocationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notified []jwt.Revocation
+	s.Subscribe(func(r jwt.Revocation) {
+		notified = append(notified, r)
+	})
+
+	if err := s.Revoke(jwt.Revocation{Kind: jwt.RevokeProxy, Value: "proxy-1"}); err != nil {
+		t.Fatal(err)
+	}
+	// Revocations added to the file by hand are picked up on reload, without dropping those already stored.
+	data, err := json.Marshal([]jwt.Revocation{{Kind: jwt.RevokeTenant, Value: "network"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notified) != 2 || notified[1].Value != "network" {
+		t.Errorf("expected subscriber to be notified of both revocations, got %+v", notified)
+	}
+	for _, claims := range []*jwt.Claims{{Proxy: "proxy-1"}, {Tenant: "network"}} {
+		if _, ok := s.Revoked(claims); !ok {
+			t.Errorf("expected token with claims %+v to be revoked", claims)
+		}
+	}
+}
+
+func TestRevocationPersistFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	s, err := jwt.NewRevocationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The revocations are written to a temporary file first, so a directory in its place makes persisting fail.
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Revoke(jwt.Revocation{Kind: jwt.RevokeProxy, Value: "proxy-1"}); err == nil {
+		t.Fatal("expected error persisting revocation")
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Revoked(&jwt.Claims{Proxy: "proxy-1"}); !ok {
+		t.Error("expected revocation that could not be persisted to survive a reload")
+	}
+}
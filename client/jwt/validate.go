@@ -1,10 +1,44 @@
 package jwt
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"fmt"
 
-func Validate(tokenString string) (*jwt.Token, bool) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	return token, err == nil && token.Valid
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Validate parses the token passed and validates its signature and claims against the current configuration.
+// The claims of the token are returned if it is valid.
+func Validate(tokenString string) (*Claims, error) {
+	cfg := config.Load()
+	if cfg == nil {
+		return nil, fmt.Errorf("token validation is not configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithIssuedAt(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.RequireExpiry {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return cfg.Keys.Key(token.Method.Alg(), kid)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("token is invalid")
+	}
+	return claims, nil
 }
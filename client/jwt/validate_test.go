@@ -0,0 +1,189 @@
+package jwt_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/rs/zerolog"
+)
+
+var secret = []byte("test-secret")
+
+// sign signs a token holding the claims passed using the method, key and key ID passed.
+func sign(t *testing.T, method gojwt.SigningMethod, key any, kid string, claims *jwt.Claims) string {
+	t.Helper()
+	token := gojwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// claims returns valid claims for a token issued by the issuer and for the audience passed, expiring in an hour.
+func claims(iss, aud string) *jwt.Claims {
+	now := time.Now()
+	c := &jwt.Claims{
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Issuer:    iss,
+			IssuedAt:  gojwt.NewNumericDate(now),
+			ExpiresAt: gojwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Tenant: "network",
+		Proxy:  "proxy-1",
+	}
+	if aud != "" {
+		c.Audience = gojwt.ClaimStrings{aud}
+	}
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	cfg := jwt.DefaultConfig(jwt.SecretKey(secret))
+	cfg.Issuer, cfg.Audience = "oomph", "ocloud"
+	jwt.Configure(cfg)
+
+	tests := map[string]struct {
+		claims func(c *jwt.Claims)
+		method gojwt.SigningMethod
+		valid  bool
+	}{
+		"valid":             {valid: true},
+		"algorithm":         {method: gojwt.SigningMethodHS512},
+		"issuer":            {claims: func(c *jwt.Claims) { c.Issuer = "other" }},
+		"audience":          {claims: func(c *jwt.Claims) { c.Audience = gojwt.ClaimStrings{"other"} }},
+		"no expiry":         {claims: func(c *jwt.Claims) { c.ExpiresAt = nil }},
+		"expired":           {claims: func(c *jwt.Claims) { c.ExpiresAt = gojwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+		"expired in leeway": {claims: func(c *jwt.Claims) { c.ExpiresAt = gojwt.NewNumericDate(time.Now().Add(-time.Second * 10)) }, valid: true},
+		"not yet valid":     {claims: func(c *jwt.Claims) { c.NotBefore = gojwt.NewNumericDate(time.Now().Add(time.Minute)) }},
+		"valid in leeway":   {claims: func(c *jwt.Claims) { c.NotBefore = gojwt.NewNumericDate(time.Now().Add(time.Second * 10)) }, valid: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := claims("oomph", "ocloud")
+			if test.claims != nil {
+				test.claims(c)
+			}
+			method := test.method
+			if method == nil {
+				method = gojwt.SigningMethodHS256
+			}
+
+			validated, err := jwt.Validate(sign(t, method, secret, "", c))
+			if test.valid && err != nil {
+				t.Fatalf("expected token to be valid, got %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected token to be invalid")
+			}
+			if test.valid && (validated.Tenant != "network" || validated.Proxy != "proxy-1") {
+				t.Errorf("unexpected claims %+v", validated)
+			}
+		})
+	}
+
+	if _, err := jwt.Validate(sign(t, gojwt.SigningMethodHS256, []byte("other-secret"), "", claims("oomph", "ocloud"))); err == nil {
+		t.Error("expected token with invalid signature to be rejected")
+	}
+	if _, err := jwt.Validate(sign(t, gojwt.SigningMethodNone, gojwt.UnsafeAllowNoneSignatureType, "", claims("oomph", "ocloud"))); err == nil {
+		t.Error("expected unsigned token to be rejected")
+	}
+}
+
+func TestValidateJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: key.Public(), KeyID: "key-1", Algorithm: "ES256", Use: "sig"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := jwt.NewJWKSProvider(path, time.Hour, time.Hour, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keys.Close()
+	jwt.Configure(jwt.DefaultConfig(keys))
+
+	if _, err := jwt.Validate(sign(t, gojwt.SigningMethodES256, key, "key-1", claims("", ""))); err != nil {
+		t.Errorf("expected token signed with known key to be valid, got %v", err)
+	}
+	if _, err := jwt.Validate(sign(t, gojwt.SigningMethodES256, key, "key-2", claims("", ""))); err == nil {
+		t.Error("expected token with unknown key ID to be rejected")
+	}
+	if _, err := jwt.Validate(sign(t, gojwt.SigningMethodHS256, secret, "key-1", claims("", ""))); err == nil {
+		t.Error("expected token signed with HS256 to be rejected")
+	}
+}
+
+// logBuffer is a buffer that log messages may be written to concurrently.
+type logBuffer struct {
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.String()
+}
+
+func TestJWKSRefreshError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key.Public(), KeyID: "key-1", Use: "sig"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf := &logBuffer{}
+	keys, err := jwt.NewJWKSProvider(path, time.Millisecond*10, time.Hour, zerolog.New(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keys.Close()
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(buf.String(), "failed to reload JWKS") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected failed reload to be logged")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -3,11 +3,15 @@ package client
 import (
 	"bytes"
 	"compress/zlib"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/oomph-ac/ocloud/client/context"
+	"github.com/oomph-ac/ocloud/metrics"
 	cloudpacket "github.com/oomph-ac/ocloud/packet"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
@@ -34,15 +38,20 @@ func (c *Client) Write(pk packet.Packet) (err error) {
 		}
 	}()
 
-	// The protocol writer is directly linked to the wBuffer of the client.
+	// The protocol writer is directly linked to the wBuffer of the client. Every packet is prefixed with its ID,
+	// just like the packets in batches sent by the proxy.
+	id := pk.ID()
+	protoWriter.Uint32(&id)
 	pk.Marshal(protoWriter)
 	c.writePks++
 
 	return nil
 }
 
-// Flush writes all pending packets to the underlying connection. An error is returned if the write to the
-// underlying connection fails.
+// Flush writes all pending packets to the underlying connection. The packets are written as a single batch, in
+// the same format as the batches sent by the proxy: a header holding the length of the compressed batch and the
+// amount of packets in it, followed by the batch compressed as a complete zlib stream. An error is returned if the
+// write to the underlying connection fails.
 func (c *Client) Flush() error {
 	if !c.connected.Load() {
 		return fmt.Errorf("client not connected")
@@ -55,27 +64,26 @@ func (c *Client) Flush() error {
 		return nil
 	}
 
-	// Write the header (length and packet count) directly to the underlying connection.
-	header := make([]byte, cloudpacket.HeaderSize)
-	header[0], header[1], header[2], header[3] = byte(c.wBuffer.Len()), byte(c.wBuffer.Len()>>8), byte(c.wBuffer.Len()>>16), byte(c.wBuffer.Len()>>24)
-	header[4], header[5], header[6], header[7], header[8], header[9], header[10], header[11] = byte(c.writePks), byte(c.writePks>>8), byte(c.writePks>>16), byte(c.writePks>>24), byte(c.writePks>>32), byte(c.writePks>>40), byte(c.writePks>>48), byte(c.writePks>>56)
-
-	// Write the header to the underlying connection.
-	if _, err := c.conn.Write(header); err != nil {
+	// The header is written in front of the compressed batch once its length is known, so that the whole batch
+	// is written to the underlying connection at once.
+	c.cBuffer.Reset()
+	c.cBuffer.Write(make([]byte, cloudpacket.HeaderSize))
+	c.compressor.Reset(c.cBuffer)
+	if _, err := c.compressor.Write(c.wBuffer.Bytes()); err != nil {
 		c.connected.Store(false)
-		return fmt.Errorf("failed to write header: %v", err)
+		return fmt.Errorf("failed to compress batch: %v", err)
 	}
-
-	// Write the compressed data to the underlying connection.
-	if _, err := c.compressor.Write(c.wBuffer.Bytes()); err != nil {
+	if err := c.compressor.Close(); err != nil {
 		c.connected.Store(false)
-		return fmt.Errorf("failed to write compressed data: %v", err)
+		return fmt.Errorf("failed to compress batch: %v", err)
 	}
 
-	// Flush the compressor to ensure all data is written to the underlying connection.
-	if err := c.compressor.Flush(); err != nil {
+	batch := c.cBuffer.Bytes()
+	binary.LittleEndian.PutUint32(batch[0:4], uint32(len(batch)-cloudpacket.HeaderSize))
+	binary.LittleEndian.PutUint64(batch[4:12], c.writePks)
+	if _, err := c.conn.Write(batch); err != nil {
 		c.connected.Store(false)
-		return fmt.Errorf("failed to flush compressed data: %v", err)
+		return fmt.Errorf("failed to write batch: %v", err)
 	}
 
 	c.writePks = 0
@@ -95,8 +103,11 @@ func (c *Client) handleDeferred() {
 		select {
 		case pk := <-c.deferredPackets:
 			ctx := context.NewPacketCtx(pk)
-			for _, handler := range c.handlers {
-				handler.Recieve(ctx)
+			for _, id := range c.handlerOrder {
+				c.handlers[id].Recieve(ctx)
+				if ctx.Cancelled() || ctx.Error() != nil {
+					break
+				}
 			}
 		default:
 			return
@@ -104,12 +115,31 @@ func (c *Client) handleDeferred() {
 	}
 }
 
-// startTicking starts the read/write loop for the client. It reads packets from the underlying connection,
-// and sends them to the pending packets channel.
+// startFlushing flushes the packets written to the client at the flush interval until the client is closed. It
+// runs separately from the read loop, so that packets are flushed even while no batches are received.
+func (c *Client) startFlushing() {
+	t := time.NewTicker(c.cfg.FlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.close:
+			return
+		case <-t.C:
+			if err := c.Flush(); err != nil {
+				c.Close(fmt.Errorf("failed to flush client: %v", err))
+				return
+			}
+		}
+	}
+}
+
+// startTicking starts the read loop for the client. It reads batches from the underlying connection and
+// processes the packets in them.
 func (c *Client) startTicking() {
 	defer func() {
 		if v := recover(); v != nil {
-			c.Close(fmt.Errorf("crashed while reading from client: %v", v))
+			c.Close(DisconnectErrorf(cloudpacket.DisconnectReasonInternalError, "crashed while reading from client: %v", v))
 			return
 		}
 		c.Close(nil)
@@ -119,27 +149,17 @@ func (c *Client) startTicking() {
 		readLength int = cloudpacket.HeaderSize
 		readPks    int = 0
 
-		readBuffer     = bytes.NewBuffer(make([]byte, cloudpacket.MaxExpectedPacketSize))
-		batchReader, _ = zlib.NewReader(readBuffer)
+		readBuffer = bytes.NewBuffer(make([]byte, c.cfg.MaxBatchSize))
 
 		readingHeader bool = true
 
 		err error
 	)
 
-	t := time.NewTicker(time.Millisecond * 500)
-	defer t.Stop()
-
 	for {
 		select {
 		case <-c.close:
 			return
-		case <-t.C:
-			// Flush the connection to write any packets we need to send to the client.
-			if err := c.Flush(); err != nil {
-				c.Close(fmt.Errorf("failed to flush client: %v", err))
-				return
-			}
 		default:
 			// Read data from the underlying connection and write it to the buffer.
 			readBuf := readBuffer.Bytes()[0:readLength]
@@ -154,7 +174,7 @@ func (c *Client) startTicking() {
 				}
 				readingHeader = false
 			} else {
-				if err = c.processBatch(batchReader, readBuffer, readLength, readPks); err != nil {
+				if err = c.processBatch(readBuf, readPks); err != nil {
 					return
 				}
 
@@ -169,12 +189,12 @@ func (c *Client) startTicking() {
 
 // readFromConnection reads data from the connection into the provided buffer.
 func (c *Client) readFromConnection(buf []byte) error {
-	_, err := io.ReadFull(c.conn, buf)
+	n, err := io.ReadFull(c.conn, buf)
+	c.bytesReceived.Add(uint64(n))
 	if err != nil && c.connected.Load() {
 		c.Close(fmt.Errorf("failed to read from connection: %v", err))
-		return err
 	}
-	return nil
+	return err
 }
 
 // parseHeader parses the packet header and returns the batch length and packet count.
@@ -185,7 +205,7 @@ func (c *Client) parseHeader(buf []byte) (_ int, _ int, err error) {
 		int(buf[2])<<16 |
 		int(buf[3])<<24
 	if batchLength > cap(buf) || batchLength < 0 {
-		err = fmt.Errorf("invalid packet length: %d", batchLength)
+		err = DisconnectErrorf(cloudpacket.DisconnectReasonInvalidBatch, "invalid packet length: %d", batchLength)
 		c.Close(err)
 		return
 	}
@@ -199,18 +219,34 @@ func (c *Client) parseHeader(buf []byte) (_ int, _ int, err error) {
 		int(buf[10])<<48 |
 		int(buf[11])<<56
 	if packetCount <= 0 {
-		err = fmt.Errorf("invalid packet count: %d", packetCount)
+		err = DisconnectErrorf(cloudpacket.DisconnectReasonInvalidBatch, "invalid packet count: %d", packetCount)
 		c.Close(err)
 		return
 	}
 	return batchLength, packetCount, nil
 }
 
-// processBatch processes a batch of packets from the decompressed data.
-func (c *Client) processBatch(batchReader io.Reader, readBuffer *bytes.Buffer, readLength int, packetCount int) error {
-	_, err := batchReader.Read(c.rBuffer.Bytes()[0:readLength])
-	if err != nil {
-		c.Close(fmt.Errorf("failed to decompress batch: %v", err))
+// processBatch decompresses the batch passed into the read buffer of the client and processes each packet in it.
+func (c *Client) processBatch(batch []byte, packetCount int) error {
+	c.batchMu.Lock()
+	if c.draining.Load() {
+		// The client is closed by whoever is draining it, so we wait for that rather than closing it here,
+		// which would close it without a Disconnect packet.
+		c.batchMu.Unlock()
+		<-c.close
+		return fmt.Errorf("client closed")
+	}
+	defer c.batchMu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		metrics.BatchLatency.Observe(time.Since(start).Seconds())
+	}()
+	metrics.BatchesReceived.Inc()
+
+	if err := c.decompress(batch); err != nil {
+		err = &DisconnectError{Reason: cloudpacket.DisconnectReasonInvalidBatch, Err: err}
+		c.Close(err)
 		return err
 	}
 
@@ -224,26 +260,51 @@ func (c *Client) processBatch(batchReader io.Reader, readBuffer *bytes.Buffer, r
 	return nil
 }
 
-// processPacket processes a single packet from the batch.
+// decompress decompresses the batch passed into the read buffer of the client, replacing any data left in it.
+// Every batch is compressed separately, so a new zlib reader is created for each of them. An error is returned if
+// the batch is not valid zlib data or if it decompresses to more than ReadBufferSize bytes.
+func (c *Client) decompress(batch []byte) error {
+	zr, err := zlib.NewReader(bytes.NewReader(batch))
+	if err != nil {
+		return fmt.Errorf("failed to decompress batch: %v", err)
+	}
+	defer zr.Close()
+
+	c.rBuffer.Reset()
+	n, err := io.Copy(c.rBuffer, io.LimitReader(zr, int64(c.cfg.ReadBufferSize)+1))
+	metrics.DecompressedBytes.Add(float64(n))
+	if err != nil {
+		return fmt.Errorf("failed to decompress batch: %v", err)
+	}
+	if n > int64(c.cfg.ReadBufferSize) {
+		return fmt.Errorf("decompressed batch exceeds %d bytes", c.cfg.ReadBufferSize)
+	}
+	return nil
+}
+
+// processPacket processes a single packet from the batch. Once the handshake is completed, only the packets
+// negotiated with the proxy are accepted.
 func (c *Client) processPacket() (err error) {
-	var (
-		protoReader = c.protoReader.Load()
-		packetId    uint32
-	)
+	protoReader := c.protoReader.Load()
 	if protoReader == nil {
-		err = fmt.Errorf("protoReader is nil")
+		err = DisconnectErrorf(cloudpacket.DisconnectReasonInternalError, "protoReader is nil")
 		c.Close(err)
 		return
 	}
-	protoReader.Uint32(&packetId)
 
-	pk := cloudpacket.Find(packetId)
-	if pk == nil {
-		err = fmt.Errorf("unknown packet ID %d", packetId)
+	pk, err := cloudpacket.Decode(protoReader)
+	if err != nil {
+		err = &DisconnectError{Reason: cloudpacket.DisconnectReasonUnknownPacket, Err: err}
 		c.Close(err)
 		return
 	}
-	pk.Marshal(protoReader)
+	if proto, ok := c.Protocol(); ok && !slices.Contains(proto.Packets, pk.ID()) {
+		err = DisconnectErrorf(cloudpacket.DisconnectReasonUnknownPacket, "packet %T was not negotiated during the handshake", pk)
+		c.Close(err)
+		return
+	}
+	c.packetsReceived.Add(1)
+	metrics.PacketsReceived.WithLabelValues(strconv.FormatUint(uint64(pk.ID()), 10)).Inc()
 
 	// Check to see if the client has been closed first before allowing handlers to be called.
 	select {
@@ -259,25 +320,44 @@ func (c *Client) handlePacket(pk packet.Packet) error {
 	// Handle any deferred packets that are waiting to be processed by the handlers.
 	c.handleDeferred()
 
-	c.hMu.RLock()
-	defer c.hMu.RUnlock()
-
-	if len(c.handlers) == 0 {
-		c.deferredPackets <- pk
-		return nil
-	}
-
 	ctx := context.NewPacketCtx(pk)
 	defer ctx.Done()
 
-	for _, handler := range c.handlers {
-		handler.Recieve(ctx)
+	// The handler lock must be released before closing the client, as Close() acquires it to close all handlers.
+	deferred, h := c.dispatch(ctx)
+	if deferred {
+		c.deferredPackets <- pk
+		return nil
 	}
 
 	if err := ctx.Error(); err != nil {
-		err = fmt.Errorf("error while processing %T: %v", pk, err)
+		metrics.HandlerErrors.WithLabelValues(fmt.Sprintf("%T", h)).Inc()
+		err = &DisconnectError{
+			Reason: disconnectReason(err, cloudpacket.DisconnectReasonProtocolViolation),
+			Err:    fmt.Errorf("error while processing %T: %w", pk, err),
+		}
 		c.Close(err)
 		return err
 	}
 	return nil
 }
+
+// dispatch calls every registered handler with the packet context passed, until one of the handlers cancels
+// the context or sets an error. The last handler called is returned. If no handlers are registered, true is
+// returned and the packet should be deferred until at least one handler is registered.
+func (c *Client) dispatch(ctx *context.PacketContext) (deferred bool, last PacketHandler) {
+	c.hMu.RLock()
+	defer c.hMu.RUnlock()
+
+	if len(c.handlers) == 0 {
+		return true, nil
+	}
+	for _, id := range c.handlerOrder {
+		last = c.handlers[id]
+		last.Recieve(ctx)
+		if ctx.Cancelled() || ctx.Error() != nil {
+			break
+		}
+	}
+	return false, last
+}
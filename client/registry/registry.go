@@ -0,0 +1,176 @@
+package registry
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/client"
+)
+
+// Registry owns all live clients, keyed by their session ID. Clients are removed from the registry automatically
+// once they are closed.
+type Registry struct {
+	clients map[uuid.UUID]*client.Client
+	mu      sync.RWMutex
+
+	// onConnect and onDisconnect are the hooks called when a client is added to and removed from the registry.
+	onConnect    []func(c *client.Client)
+	onDisconnect []func(c *client.Client)
+	hookMu       sync.RWMutex
+
+	// wg tracks the clients in the registry, so that Wait can block until all clients are removed.
+	wg sync.WaitGroup
+}
+
+// New returns a new, empty Registry.
+func New() *Registry {
+	return &Registry{clients: make(map[uuid.UUID]*client.Client)}
+}
+
+// OnConnect registers a function that is called with every client added to the registry.
+func (r *Registry) OnConnect(f func(c *client.Client)) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+
+	r.onConnect = append(r.onConnect, f)
+}
+
+// OnDisconnect registers a function that is called with every client removed from the registry once it is closed.
+func (r *Registry) OnDisconnect(f func(c *client.Client)) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+
+	r.onDisconnect = append(r.onDisconnect, f)
+}
+
+// Add adds the client passed to the registry. The client is removed once it is closed.
+func (r *Registry) Add(c *client.Client) {
+	r.mu.Lock()
+	r.clients[c.SessionID()] = c
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	r.call(r.onConnect, c)
+	go func() {
+		<-c.Done()
+		r.remove(c)
+	}()
+}
+
+// remove removes the client passed from the registry and calls the OnDisconnect hooks.
+func (r *Registry) remove(c *client.Client) {
+	r.mu.Lock()
+	delete(r.clients, c.SessionID())
+	r.mu.Unlock()
+
+	r.call(r.onDisconnect, c)
+	r.wg.Done()
+}
+
+// call calls all hooks passed with the client passed.
+func (r *Registry) call(hooks []func(c *client.Client), c *client.Client) {
+	r.hookMu.RLock()
+	defer r.hookMu.RUnlock()
+
+	for _, f := range hooks {
+		f(c)
+	}
+}
+
+// Client returns the client with the session ID passed. False is returned if no such client is registered.
+func (r *Registry) Client(sessionID uuid.UUID) (*client.Client, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.clients[sessionID]
+	return c, ok
+}
+
+// Clients returns all clients in the registry.
+func (r *Registry) Clients() []*client.Client {
+	return r.filter(func(*client.Client) bool { return true })
+}
+
+// ByTenant returns all clients belonging to the tenant passed.
+func (r *Registry) ByTenant(tenant string) []*client.Client {
+	return r.filter(func(c *client.Client) bool {
+		return c.Tenant() == tenant
+	})
+}
+
+// ByPlayer returns all clients of the player with the XUID or display name passed. Display names are matched
+// case-insensitively.
+func (r *Registry) ByPlayer(player string) []*client.Client {
+	return r.filter(func(c *client.Client) bool {
+		id, ok := c.Identity()
+		return ok && (id.XUID == player || strings.EqualFold(id.DisplayName, player))
+	})
+}
+
+// ByAddr returns all clients connected from the address passed. The address may either be a host, matching
+// all ports, or a host and port.
+func (r *Registry) ByAddr(addr string) []*client.Client {
+	return r.filter(func(c *client.Client) bool {
+		remote := c.Addr().String()
+		if remote == addr {
+			return true
+		}
+		host, _, err := net.SplitHostPort(remote)
+		return err == nil && host == addr
+	})
+}
+
+// filter returns all clients for which the function passed returns true.
+func (r *Registry) filter(f func(c *client.Client) bool) []*client.Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make([]*client.Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		if f(c) {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// Len returns the amount of clients in the registry.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.clients)
+}
+
+// TenantCounts returns the amount of clients in the registry per tenant. Clients that are not yet
+// authenticated are counted under an empty tenant.
+func (r *Registry) TenantCounts() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, c := range r.clients {
+		counts[c.Tenant()]++
+	}
+	return counts
+}
+
+// DeferredPackets returns the total amount of packets queued by all clients in the registry until a handler
+// is registered.
+func (r *Registry) DeferredPackets() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int
+	for _, c := range r.clients {
+		n += c.DeferredPackets()
+	}
+	return n
+}
+
+// Wait blocks until all clients in the registry have been closed and removed.
+func (r *Registry) Wait() {
+	r.wg.Wait()
+}
@@ -0,0 +1,105 @@
+package registry_test
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/identity"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/client/registry"
+	"github.com/oomph-ac/ocloud/internal/pipe"
+	"github.com/rs/zerolog"
+)
+
+// connect returns a client of the tenant and player passed, reading from a pipe whose other end is drained.
+func connect(t *testing.T, tenant, player string) *client.Client {
+	t.Helper()
+	stream, proxyConn := pipe.New()
+	go func() {
+		_, _ = io.Copy(io.Discard, proxyConn)
+	}()
+	c := client.New(stream, stream.RemoteAddr(), zerolog.Nop(), client.DefaultConfig())
+	t.Cleanup(func() {
+		_ = c.Close(nil)
+		_ = proxyConn.Close()
+	})
+	c.SetClaims(&jwt.Claims{Tenant: tenant})
+	c.SetIdentity(identity.Identity{XUID: player + "-xuid", DisplayName: player})
+	return c
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := registry.New()
+	a, b, c := connect(t, "a", "Steve"), connect(t, "a", "Alex"), connect(t, "b", "Steve")
+	for _, cl := range []*client.Client{a, b, c} {
+		r.Add(cl)
+	}
+
+	if cl, ok := r.Client(b.SessionID()); !ok || cl != b {
+		t.Errorf("expected client to be found by its session ID")
+	}
+	if r.Len() != 3 || len(r.Clients()) != 3 {
+		t.Errorf("expected 3 clients, got %d", r.Len())
+	}
+	if clients := r.ByTenant("a"); len(clients) != 2 || !slices.Contains(clients, a) || !slices.Contains(clients, b) {
+		t.Errorf("expected both clients of tenant a, got %v", clients)
+	}
+	if clients := r.ByPlayer("steve"); len(clients) != 2 || !slices.Contains(clients, a) || !slices.Contains(clients, c) {
+		t.Errorf("expected both clients of Steve matched case-insensitively, got %v", clients)
+	}
+	if clients := r.ByPlayer("Alex-xuid"); len(clients) != 1 || clients[0] != b {
+		t.Errorf("expected client of Alex to be found by XUID, got %v", clients)
+	}
+	// Clients connected over a pipe all have the same address.
+	if clients := r.ByAddr(a.Addr().String()); len(clients) != 3 {
+		t.Errorf("expected all clients to be found by address, got %v", clients)
+	}
+	if counts := r.TenantCounts(); counts["a"] != 2 || counts["b"] != 1 {
+		t.Errorf("unexpected tenant counts %v", counts)
+	}
+}
+
+func TestRegistryHooks(t *testing.T) {
+	r := registry.New()
+	var connected []*client.Client
+	r.OnConnect(func(c *client.Client) {
+		connected = append(connected, c)
+	})
+	disconnected := make(chan *client.Client, 1)
+	r.OnDisconnect(func(c *client.Client) {
+		disconnected <- c
+	})
+
+	c := connect(t, "a", "Steve")
+	r.Add(c)
+	if len(connected) != 1 || connected[0] != c {
+		t.Fatalf("expected OnConnect to be called with the client added, got %v", connected)
+	}
+
+	_ = c.Close(nil)
+	select {
+	case cl := <-disconnected:
+		if cl != c {
+			t.Errorf("expected OnDisconnect to be called with the client closed, got %v", cl)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected OnDisconnect to be called once the client was closed")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Wait to return once all clients were removed")
+	}
+	if _, ok := r.Client(c.SessionID()); ok || r.Len() != 0 {
+		t.Error("expected client to be removed once closed")
+	}
+}
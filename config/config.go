@@ -0,0 +1,273 @@
+package config
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds all options of the server. It is loaded from a YAML file, after which environment variables and
+// command line flags override the options they set.
+type Config struct {
+	// Path is the path of the file the configuration was loaded from. It is empty if no file was used.
+	Path string `yaml:"-"`
+
+	Listener ListenerConfig `yaml:"listener"`
+	HTTP     HTTPConfig     `yaml:"http"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Limits   LimitsConfig   `yaml:"limits"`
+	Logging  LoggingConfig  `yaml:"logging"`
+	Sentry   SentryConfig   `yaml:"sentry"`
+	Reload   ReloadConfig   `yaml:"reload"`
+}
+
+// ListenerConfig holds the options of the QUIC listener.
+type ListenerConfig struct {
+	// Address is the UDP address the server listens on.
+	Address string `yaml:"address"`
+	// KeepAlivePeriod is the interval at which keep-alive packets are sent to proxies.
+	KeepAlivePeriod time.Duration `yaml:"keep_alive_period"`
+	// ShutdownTimeout is the maximum time spent disconnecting clients and finalizing their recordings when the
+	// server shuts down.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// HTTPConfig holds the options of the HTTP server exposing metrics and other endpoints.
+type HTTPConfig struct {
+	// Address is the TCP address the HTTP server listens on. If empty, the HTTP server is disabled.
+	Address string `yaml:"address"`
+}
+
+// TLSConfig holds the certificates used for the QUIC listener.
+type TLSConfig struct {
+	// CertFile is the path of the certificate of the server.
+	CertFile string `yaml:"cert_file"`
+	// KeyFile is the path of the private key of the certificate of the server.
+	KeyFile string `yaml:"key_file"`
+	// ClientCAFile is the path of the CA bundle used to verify client certificates presented by proxies. If
+	// empty, client certificates are not requested.
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// AuthConfig holds the options used to authenticate proxies.
+type AuthConfig struct {
+	// Mode is the mode determining the credentials proxies must present. It is one of "token", "certificate"
+	// or "both".
+	Mode string `yaml:"mode"`
+	// RevocationsPath is the path of the file holding revoked tokens.
+	RevocationsPath string `yaml:"revocations_path"`
+	// JWT holds the rules that tokens are validated against. Tokens are also used to authenticate requests to
+	// the admin and replay APIs, so JWT may be set in any mode.
+	JWT JWTConfig `yaml:"jwt"`
+}
+
+// JWTConfig holds the rules that tokens are validated against.
+type JWTConfig struct {
+	// JWKS is the file path or URL of the JWKS holding the keys used to verify tokens. It takes precedence
+	// over Secret.
+	JWKS string `yaml:"jwks"`
+	// JWKSRefresh is the interval at which the JWKS is reloaded.
+	JWKSRefresh time.Duration `yaml:"jwks_refresh"`
+	// JWKSGrace is the duration that keys removed from the JWKS are still accepted for.
+	JWKSGrace time.Duration `yaml:"jwks_grace"`
+	// Secret is the HMAC secret used to verify tokens if no JWKS is set.
+	Secret string `yaml:"secret"`
+	// Issuer is the required "iss" claim of tokens. If empty, the issuer is not checked.
+	Issuer string `yaml:"issuer"`
+	// Audience is the required "aud" claim of tokens. If empty, the audience is not checked.
+	Audience string `yaml:"audience"`
+	// Algorithms is the list of signing algorithms accepted. If empty, the defaults for the kind of key are
+	// used.
+	Algorithms []string `yaml:"algorithms"`
+	// Leeway is the clock skew allowed when checking the time claims of tokens.
+	Leeway time.Duration `yaml:"leeway"`
+	// AllowNoExpiry accepts tokens that have no "exp" claim.
+	AllowNoExpiry bool `yaml:"allow_no_expiry"`
+}
+
+// StorageConfig holds the locations that recordings and related data are stored in.
+type StorageConfig struct {
+	// RecordingDir is the directory that session recordings are stored in.
+	RecordingDir string `yaml:"recording_dir"`
+	// CataloguePath is the path of the session catalogue. If empty, it is stored in the recording directory.
+	CataloguePath string `yaml:"catalogue_path"`
+	// TenantPolicies is the path of the file holding the quotas and retention policies of tenants. If empty,
+	// no limits apply and recordings are kept forever.
+	TenantPolicies string `yaml:"tenant_policies"`
+	// JanitorInterval is the interval at which recordings that outlived their retention policy are deleted.
+	JanitorInterval time.Duration `yaml:"janitor_interval"`
+}
+
+// LimitsConfig holds the options of the streams of proxies.
+type LimitsConfig struct {
+	// FlushInterval is the interval at which packets written to proxies are flushed.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// CompressionLevel is the zlib compression level used for batches written to proxies.
+	CompressionLevel int `yaml:"compression_level"`
+	// MaxBatchSize is the maximum size of a compressed batch sent by a proxy.
+	MaxBatchSize int `yaml:"max_batch_size"`
+	// ReadBufferSize is the size of the buffer holding a decompressed batch sent by a proxy. It limits the size of
+	// a batch after decompression, so batches decompressing to more bytes are rejected. It is independent of
+	// MaxBatchSize, which limits the size of a batch before decompression.
+	ReadBufferSize int `yaml:"read_buffer_size"`
+	// WriteBufferSize is the initial size of the buffer holding packets written to a proxy.
+	WriteBufferSize int `yaml:"write_buffer_size"`
+}
+
+// LoggingConfig holds the options of the server log.
+type LoggingConfig struct {
+	// File is the path of the log file. If empty, logs are written to stderr.
+	File string `yaml:"file"`
+	// Level is the minimum level of the messages logged, such as "debug" or "info".
+	Level string `yaml:"level"`
+}
+
+// SentryConfig holds the options of the Sentry error reporting.
+type SentryConfig struct {
+	// DSN is the DSN of the Sentry project that errors are reported to. If empty, Sentry is disabled.
+	DSN string `yaml:"dsn"`
+}
+
+// ReloadConfig holds the options of reloading the configuration while the server is running. The configuration
+// is always reloaded when the server receives SIGHUP.
+type ReloadConfig struct {
+	// WatchInterval is the interval at which the configuration file, TLS certificate and tenant policies are
+	// checked for changes, reloading the configuration if any of them changed. If zero, files are not watched.
+	WatchInterval time.Duration `yaml:"watch_interval"`
+}
+
+// maxBufferSize is the maximum size of the batches and buffers configured in LimitsConfig. The buffers are
+// allocated for every client, so sizes beyond this are never reasonable and most likely a typo.
+const maxBufferSize = 1024 * 1024 * 1024
+
+// Default returns the default configuration. The TLS certificate and the keys used to verify tokens have no
+// default and must always be configured.
+func Default() Config {
+	return Config{
+		Listener: ListenerConfig{
+			Address:         "0.0.0.0:19133",
+			KeepAlivePeriod: time.Second,
+			ShutdownTimeout: time.Second * 10,
+		},
+		HTTP: HTTPConfig{
+			Address: "127.0.0.1:8080",
+		},
+		Auth: AuthConfig{
+			Mode:            "token",
+			RevocationsPath: "revocations.json",
+			JWT: JWTConfig{
+				JWKSRefresh: time.Minute * 5,
+				JWKSGrace:   time.Hour,
+				Leeway:      time.Second * 30,
+			},
+		},
+		Storage: StorageConfig{
+			RecordingDir:    "recordings",
+			JanitorInterval: time.Hour,
+		},
+		Limits: LimitsConfig{
+			FlushInterval:    time.Millisecond * 500,
+			CompressionLevel: 7,
+			MaxBatchSize:     4 * 1024 * 1024,
+			ReadBufferSize:   10 * 1024 * 1024,
+			WriteBufferSize:  65535,
+		},
+		Logging: LoggingConfig{
+			File:  "server.log",
+			Level: "info",
+		},
+		Reload: ReloadConfig{
+			WatchInterval: time.Second * 10,
+		},
+	}
+}
+
+// Load loads the configuration from the YAML file at the path passed, on top of the default configuration.
+// Unknown options in the file are rejected, so that typos are not silently ignored.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to open config: %v", err)
+	}
+	defer f.Close()
+
+	cfg.Path = path
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that the configuration is complete and that all options hold sensible values. All problems
+// found are returned at once.
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, option, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", option, fmt.Sprintf(format, a...)))
+		}
+	}
+	fileExists := func(option, path string) {
+		if path == "" {
+			return
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", option, err))
+		}
+	}
+
+	check(cfg.Listener.Address != "", "listener.address", "must be set")
+	check(cfg.Listener.KeepAlivePeriod >= 0, "listener.keep_alive_period", "must not be negative")
+	check(cfg.Listener.ShutdownTimeout > 0, "listener.shutdown_timeout", "must be positive")
+
+	check(cfg.TLS.CertFile != "", "tls.cert_file", "must be set")
+	check(cfg.TLS.KeyFile != "", "tls.key_file", "must be set")
+	fileExists("tls.cert_file", cfg.TLS.CertFile)
+	fileExists("tls.key_file", cfg.TLS.KeyFile)
+	fileExists("tls.client_ca_file", cfg.TLS.ClientCAFile)
+
+	modes := []string{"token", "certificate", "both"}
+	check(slices.Contains(modes, cfg.Auth.Mode), "auth.mode", "must be one of %v, got %q", modes, cfg.Auth.Mode)
+	if cfg.Auth.Mode == "certificate" || cfg.Auth.Mode == "both" {
+		check(cfg.TLS.ClientCAFile != "", "tls.client_ca_file", "must be set to authenticate proxies by their client certificate")
+	}
+	if cfg.Auth.Mode != "certificate" {
+		check(cfg.Auth.JWT.JWKS != "" || cfg.Auth.JWT.Secret != "", "auth.jwt", "either jwks or secret must be set")
+	}
+	check(cfg.Auth.RevocationsPath != "", "auth.revocations_path", "must be set")
+	check(cfg.Auth.JWT.JWKSRefresh > 0, "auth.jwt.jwks_refresh", "must be positive")
+	check(cfg.Auth.JWT.JWKSGrace >= 0, "auth.jwt.jwks_grace", "must not be negative")
+	check(cfg.Auth.JWT.Leeway >= 0, "auth.jwt.leeway", "must not be negative")
+
+	check(cfg.Storage.RecordingDir != "", "storage.recording_dir", "must be set")
+	check(cfg.Storage.JanitorInterval > 0, "storage.janitor_interval", "must be positive")
+	fileExists("storage.tenant_policies", cfg.Storage.TenantPolicies)
+
+	check(cfg.Limits.FlushInterval > 0, "limits.flush_interval", "must be positive")
+	check(cfg.Limits.CompressionLevel >= zlib.HuffmanOnly && cfg.Limits.CompressionLevel <= zlib.BestCompression,
+		"limits.compression_level", "must be between %d and %d", zlib.HuffmanOnly, zlib.BestCompression)
+	bufferSize := func(option string, size int) {
+		check(size > 0 && size <= maxBufferSize, option, "must be between 1 and %d, got %d", maxBufferSize, size)
+	}
+	bufferSize("limits.max_batch_size", cfg.Limits.MaxBatchSize)
+	bufferSize("limits.read_buffer_size", cfg.Limits.ReadBufferSize)
+	bufferSize("limits.write_buffer_size", cfg.Limits.WriteBufferSize)
+
+	check(cfg.Reload.WatchInterval >= 0, "reload.watch_interval", "must not be negative")
+
+	_, err := zerolog.ParseLevel(cfg.Logging.Level)
+	check(err == nil, "logging.level", "unknown level %q", cfg.Logging.Level)
+
+	return errors.Join(errs...)
+}
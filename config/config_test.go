@@ -0,0 +1,105 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oomph-ac/ocloud/config"
+)
+
+// writeFile writes the data passed to a file named name in the directory passed, returning its path.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	cert := writeFile(t, dir, "cert.pem", "")
+	key := writeFile(t, dir, "key.pem", "")
+	path := writeFile(t, dir, "config.yaml", `
+listener:
+  address: ":19133"
+  shutdown_timeout: 30s
+tls:
+  cert_file: `+cert+`
+  key_file: `+key+`
+auth:
+  jwt:
+    secret: file-secret
+limits:
+  flush_interval: 1s
+logging:
+  level: debug
+`)
+	t.Setenv("JWT_SECRET", "env-secret")
+	t.Setenv("FLUSH_INTERVAL", "2s")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	cfg, err := config.Parse("ocloud", []string{"-config", path, "-log-level", "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Path != path {
+		t.Errorf("expected path %q, got %q", path, cfg.Path)
+	}
+	if cfg.Listener.Address != ":19133" || cfg.Listener.ShutdownTimeout != time.Second*30 {
+		t.Errorf("expected listener options from file, got %+v", cfg.Listener)
+	}
+	if cfg.Auth.JWT.Secret != "env-secret" || cfg.Limits.FlushInterval != time.Second*2 {
+		t.Error("expected environment variables to override the file")
+	}
+	if cfg.Logging.Level != "error" {
+		t.Errorf("expected flags to override environment variables, got level %q", cfg.Logging.Level)
+	}
+	if cfg.Limits.MaxBatchSize != config.Default().Limits.MaxBatchSize {
+		t.Error("expected options not set to keep their default")
+	}
+}
+
+func TestLoadUnknownOption(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.yaml", "listener:\n  adress: \":19133\"\n")
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "adress") {
+		t.Errorf("expected unknown option to be rejected, got %v", err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Setenv("FLUSH_INTERVAL", "soon")
+	if _, err := config.Parse("ocloud", nil); err == nil || !strings.Contains(err.Error(), "FLUSH_INTERVAL") {
+		t.Errorf("expected invalid environment variable to be reported, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Mode = "password"
+	cfg.Limits.ReadBufferSize = 0
+	cfg.Limits.WriteBufferSize = 2 * 1024 * 1024 * 1024
+	cfg.Logging.Level = "loud"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected invalid configuration to be rejected")
+	}
+	for _, option := range []string{"tls.cert_file", "tls.key_file", "auth.mode", "limits.read_buffer_size", "limits.write_buffer_size", "logging.level"} {
+		if !strings.Contains(err.Error(), option) {
+			t.Errorf("expected error for %s, got %v", option, err)
+		}
+	}
+
+	// The read buffer limits the size of batches after decompression, so it may be smaller than the maximum size
+	// of a batch before decompression.
+	cfg = config.Default()
+	cfg.Limits.ReadBufferSize = cfg.Limits.MaxBatchSize - 1
+	if err := cfg.Validate(); err != nil && strings.Contains(err.Error(), "limits") {
+		t.Errorf("expected read buffer smaller than the maximum batch size to be accepted, got %v", err)
+	}
+}
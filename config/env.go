@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyEnv overrides the options of the configuration with those set in environment variables. Every option
+// that may be overridden has a fixed environment variable, listed below.
+func (cfg *Config) ApplyEnv() error {
+	vars := []struct {
+		key string
+		set func(v string) error
+	}{
+		{"LISTEN_ADDR", setString(&cfg.Listener.Address)},
+		{"KEEP_ALIVE_PERIOD", setDuration(&cfg.Listener.KeepAlivePeriod)},
+		{"SHUTDOWN_TIMEOUT", setDuration(&cfg.Listener.ShutdownTimeout)},
+		{"HTTP_ADDR", setString(&cfg.HTTP.Address)},
+		{"TLS_CERT_FILE", setString(&cfg.TLS.CertFile)},
+		{"TLS_KEY_FILE", setString(&cfg.TLS.KeyFile)},
+		{"CLIENT_CA_FILE", setString(&cfg.TLS.ClientCAFile)},
+		{"AUTH_MODE", setString(&cfg.Auth.Mode)},
+		{"REVOCATIONS_PATH", setString(&cfg.Auth.RevocationsPath)},
+		{"JWT_JWKS", setString(&cfg.Auth.JWT.JWKS)},
+		{"JWT_JWKS_REFRESH", setDuration(&cfg.Auth.JWT.JWKSRefresh)},
+		{"JWT_JWKS_GRACE", setDuration(&cfg.Auth.JWT.JWKSGrace)},
+		{"JWT_SECRET", setString(&cfg.Auth.JWT.Secret)},
+		{"JWT_ISSUER", setString(&cfg.Auth.JWT.Issuer)},
+		{"JWT_AUDIENCE", setString(&cfg.Auth.JWT.Audience)},
+		{"JWT_ALGORITHMS", setList(&cfg.Auth.JWT.Algorithms)},
+		{"JWT_LEEWAY", setDuration(&cfg.Auth.JWT.Leeway)},
+		{"JWT_ALLOW_NO_EXPIRY", setBool(&cfg.Auth.JWT.AllowNoExpiry)},
+		{"RECORDING_DIR", setString(&cfg.Storage.RecordingDir)},
+		{"CATALOGUE_PATH", setString(&cfg.Storage.CataloguePath)},
+		{"TENANT_POLICIES", setString(&cfg.Storage.TenantPolicies)},
+		{"JANITOR_INTERVAL", setDuration(&cfg.Storage.JanitorInterval)},
+		{"FLUSH_INTERVAL", setDuration(&cfg.Limits.FlushInterval)},
+		{"COMPRESSION_LEVEL", setInt(&cfg.Limits.CompressionLevel)},
+		{"MAX_BATCH_SIZE", setInt(&cfg.Limits.MaxBatchSize)},
+		{"READ_BUFFER_SIZE", setInt(&cfg.Limits.ReadBufferSize)},
+		{"WRITE_BUFFER_SIZE", setInt(&cfg.Limits.WriteBufferSize)},
+		{"LOG_FILE", setString(&cfg.Logging.File)},
+		{"LOG_LEVEL", setString(&cfg.Logging.Level)},
+		{"SENTRY_DSN", setString(&cfg.Sentry.DSN)},
+		{"RELOAD_WATCH_INTERVAL", setDuration(&cfg.Reload.WatchInterval)},
+	}
+
+	var errs []error
+	for _, v := range vars {
+		value, ok := os.LookupEnv(v.key)
+		if !ok {
+			continue
+		}
+		if err := v.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %v", v.key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setString(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func setList(p *[]string) func(string) error {
+	return func(v string) error {
+		*p = strings.Split(v, ",")
+		return nil
+	}
+}
+
+func setDuration(p *time.Duration) func(string) error {
+	return func(v string) (err error) {
+		*p, err = time.ParseDuration(v)
+		return
+	}
+}
+
+func setInt(p *int) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.Atoi(v)
+		return
+	}
+}
+
+func setBool(p *bool) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.ParseBool(v)
+		return
+	}
+}
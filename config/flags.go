@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// Parse parses the command line arguments passed and returns the resulting configuration. The configuration is
+// built from the defaults, the YAML file passed with -config, environment variables and finally the remaining
+// flags, each overriding the options set by the former. The configuration is validated before it is returned.
+func Parse(name string, args []string) (Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", "", "path of the YAML configuration file")
+
+	overrides := make(map[string]func(cfg *Config) func(string) error)
+	option := func(name, usage string, set func(cfg *Config) func(string) error) {
+		fs.String(name, "", usage)
+		overrides[name] = set
+	}
+	option("listen", "UDP address to listen on", func(cfg *Config) func(string) error {
+		return setString(&cfg.Listener.Address)
+	})
+	option("cert", "path of the TLS certificate", func(cfg *Config) func(string) error {
+		return setString(&cfg.TLS.CertFile)
+	})
+	option("key", "path of the TLS private key", func(cfg *Config) func(string) error {
+		return setString(&cfg.TLS.KeyFile)
+	})
+	option("client-ca", "path of the CA bundle used to verify client certificates", func(cfg *Config) func(string) error {
+		return setString(&cfg.TLS.ClientCAFile)
+	})
+	option("auth-mode", "credentials proxies must present: token, certificate or both", func(cfg *Config) func(string) error {
+		return setString(&cfg.Auth.Mode)
+	})
+	option("recording-dir", "directory that recordings are stored in", func(cfg *Config) func(string) error {
+		return setString(&cfg.Storage.RecordingDir)
+	})
+	option("log-file", "path of the log file, or empty to log to stderr", func(cfg *Config) func(string) error {
+		return setString(&cfg.Logging.File)
+	})
+	option("log-level", "minimum level of the messages logged", func(cfg *Config) func(string) error {
+		return setString(&cfg.Logging.Level)
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %v, options must be passed as flags", fs.Args())
+	}
+
+	cfg := Default()
+	if *path != "" {
+		var err error
+		if cfg, err = Load(*path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.ApplyEnv(); err != nil {
+		return cfg, err
+	}
+
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		if set, ok := overrides[f.Name]; ok {
+			if err := set(&cfg)(f.Value.String()); err != nil {
+				errs = append(errs, fmt.Errorf("invalid -%s: %v", f.Name, err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
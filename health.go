@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/client/jwt"
+)
+
+var (
+	// listening is true while the QUIC listener is accepting connections.
+	listening atomic.Bool
+	// shuttingDown is set once the server starts shutting down.
+	shuttingDown atomic.Bool
+)
+
+// handleHealth reports whether the process is alive. It succeeds as long as the HTTP server is able to respond.
+func handleHealth(w http.ResponseWriter, _ *http.Request) {
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// handleReady reports whether the server is ready to accept proxies. It fails with a list of the problems found
+// if the server is not ready, such as while it is shutting down.
+func handleReady(w http.ResponseWriter, _ *http.Request) {
+	if err := ready(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// ready checks that the QUIC listener is up, the TLS certificate and token verification keys are loaded and the
+// recording directory is writable. All problems found are returned at once.
+func ready() error {
+	var errs []error
+	if shuttingDown.Load() {
+		errs = append(errs, errors.New("server is shutting down"))
+	} else if !listening.Load() {
+		errs = append(errs, errors.New("listener is not accepting connections"))
+	}
+	if certificate.Load() == nil {
+		errs = append(errs, errors.New("TLS certificate is not loaded"))
+	}
+	if authMode != handler.AuthModeCertificate {
+		if jwtCfg, ok := jwt.Current(); !ok || jwtCfg.Keys == nil {
+			errs = append(errs, errors.New("token verification keys are not loaded"))
+		}
+	}
+	if err := checkWritable(cfg.Load().Storage.RecordingDir); err != nil {
+		errs = append(errs, fmt.Errorf("recording directory is not writable: %v", err))
+	}
+	return errors.Join(errs...)
+}
+
+// checkWritable checks that files can be created in the directory passed.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/config"
+	"github.com/oomph-ac/ocloud/internal/pipe"
+	"github.com/quic-go/quic-go"
+	"github.com/rs/zerolog"
+)
+
+// start sets up the server with its storage in a temporary directory and a self-signed certificate, and starts
+// listening on a local UDP port. The listener and transport are returned so that the server can be shut down.
+func start(t *testing.T) (*quic.Listener, *quic.Transport) {
+	t.Helper()
+	dir := t.TempDir()
+	c := config.Default()
+	c.Auth.JWT.Secret = "test-secret"
+	c.Auth.RevocationsPath = filepath.Join(dir, "revocations.json")
+	c.Storage.RecordingDir = filepath.Join(dir, "recordings")
+	c.Logging.File = filepath.Join(dir, "ocloud.log")
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	certificate.Store(&cert)
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &quic.Transport{Conn: udpConn}
+	l, err := tr.Listen(&tls.Config{Certificates: []tls.Certificate{cert}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listening.Store(true)
+	t.Cleanup(func() {
+		listening.Store(false)
+		shuttingDown.Store(false)
+		certificate.Store(nil)
+	})
+	return l, tr
+}
+
+// get performs a request to the handler passed, returning the status code and body of the response.
+func get(handler http.HandlerFunc) (int, string) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealth(t *testing.T) {
+	if code, body := get(handleHealth); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("expected process to be healthy, got %d: %q", code, body)
+	}
+}
+
+func TestReady(t *testing.T) {
+	start(t)
+	if code, body := get(handleReady); code != http.StatusOK {
+		t.Fatalf("expected server to be ready, got %d: %q", code, body)
+	}
+
+	listening.Store(false)
+	certificate.Store(nil)
+	code, body := get(handleReady)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected server not to be ready, got %d", code)
+	}
+	// All problems found are reported at once.
+	for _, problem := range []string{"listener is not accepting connections", "TLS certificate is not loaded"} {
+		if !strings.Contains(body, problem) {
+			t.Errorf("expected %q to be reported, got %q", problem, body)
+		}
+	}
+}
+
+func TestReadyDuringDrain(t *testing.T) {
+	l, tr := start(t)
+
+	// The proxy end of the pipe is not read from until readiness was checked, so that writing the Disconnect
+	// packet blocks and the server stays in the middle of draining the client.
+	stream, proxyConn := pipe.New()
+	defer proxyConn.Close()
+	c := client.New(stream, stream.RemoteAddr(), zerolog.Nop(), client.DefaultConfig())
+	clients.Add(c)
+
+	done := make(chan struct{})
+	go func() {
+		shutdown(l, tr, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for code, body := get(handleReady); !strings.Contains(body, "server is shutting down"); code, body = get(handleReady) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected server not to be ready while draining, got %d: %q", code, body)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	select {
+	case <-done:
+		t.Fatal("expected shutdown to wait for the client to be drained")
+	default:
+	}
+
+	go func() {
+		_, _ = io.Copy(io.Discard, proxyConn)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected shutdown to complete once the client was drained")
+	}
+	if code, _ := get(handleReady); code != http.StatusServiceUnavailable {
+		t.Errorf("expected server not to be ready after shutting down, got %d", code)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oomph-ac/ocloud/api"
+	"github.com/oomph-ac/ocloud/metrics"
+)
+
+// startHTTP starts the HTTP server exposing metrics, health checks and the admin and replay APIs on the address
+// passed. Nil is returned if the address is empty, in which case the HTTP server is disabled.
+func startHTTP(addr string) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /healthz", handleHealth)
+	mux.HandleFunc("GET /readyz", handleReady)
+	api.NewAdmin(clients, revocations).Register(mux)
+	api.NewReplay(sessions, revocations).Register(mux)
+	if !tokensConfigured(cfg.Load().Auth.JWT) {
+		logger.Warn().Msg("auth.jwt is not set, so the admin and replay APIs reject every request")
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("HTTP server failed")
+			fmt.Printf("HTTP server failed: %v\n", err)
+		}
+	}()
+	return srv
+}
+
+// stopHTTP stops the HTTP server passed, waiting at most the timeout passed for requests in progress to
+// complete.
+func stopHTTP(srv *http.Server, timeout time.Duration) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("failed to shut down HTTP server")
+	}
+}
@@ -0,0 +1,111 @@
+// Package metrics holds the Prometheus metrics exported by the server.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ocloud"
+
+var (
+	// Registry is the registry all metrics of the server are registered with.
+	Registry = prometheus.NewRegistry()
+
+	// ConnectionsAccepted counts the QUIC connections accepted from proxies.
+	ConnectionsAccepted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_accepted_total",
+		Help:      "QUIC connections accepted from proxies.",
+	})
+	// StreamsAccepted counts the streams accepted from proxies.
+	StreamsAccepted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "streams_accepted_total",
+		Help:      "Streams accepted from proxies.",
+	})
+	// StreamsPerConnection observes the amount of streams opened over a connection once it is closed.
+	StreamsPerConnection = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "streams_per_connection",
+		Help:      "Streams opened over a QUIC connection during its lifetime.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+	// Authentications counts the authentication attempts of proxies by their result, and the reason for failed
+	// attempts.
+	Authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authentications_total",
+		Help:      "Authentication attempts of proxies by result (success, refreshed or failure) and failure reason.",
+	}, []string{"result", "reason"})
+	// BatchesReceived counts the batches received from proxies.
+	BatchesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "batches_received_total",
+		Help:      "Batches received from proxies.",
+	})
+	// PacketsReceived counts the packets received from proxies by packet ID.
+	PacketsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packets_received_total",
+		Help:      "Packets received from proxies by packet ID.",
+	}, []string{"packet_id"})
+	// DecompressedBytes counts the bytes of batches received from proxies after decompression.
+	DecompressedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decompressed_bytes_total",
+		Help:      "Bytes of batches received from proxies after decompression.",
+	})
+	// BatchLatency observes the time taken to process a batch received from a proxy.
+	BatchLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_processing_seconds",
+		Help:      "Time taken to decompress and handle a batch received from a proxy.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	})
+	// HandlerErrors counts the errors set by packet handlers by handler.
+	HandlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_errors_total",
+		Help:      "Errors returned by packet handlers by handler.",
+	}, []string{"handler"})
+	// SessionDuration observes the time sessions were connected for by tenant once they are closed.
+	SessionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "session_duration_seconds",
+		Help:      "Time sessions were connected for by tenant. Sessions never authenticated have an empty tenant.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"tenant"})
+	// RecordingBytes counts the bytes written to recordings by tenant.
+	RecordingBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "recording_bytes_written_total",
+		Help:      "Bytes written to session recordings by tenant.",
+	}, []string{"tenant"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ConnectionsAccepted,
+		StreamsAccepted,
+		StreamsPerConnection,
+		Authentications,
+		BatchesReceived,
+		PacketsReceived,
+		DecompressedBytes,
+		BatchLatency,
+		HandlerErrors,
+		SessionDuration,
+		RecordingBytes,
+	)
+}
+
+// Handler returns the HTTP handler serving all metrics registered with the Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	activeSessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_sessions"),
+		"Sessions currently connected by tenant. Sessions not yet authenticated have an empty tenant.",
+		[]string{"tenant"}, nil,
+	)
+	deferredPacketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deferred_packets"),
+		"Packets queued by sessions until a handler is registered.",
+		nil, nil,
+	)
+)
+
+// SessionSource provides the state of the sessions currently connected.
+type SessionSource interface {
+	// TenantCounts returns the amount of sessions connected per tenant.
+	TenantCounts() map[string]int
+	// DeferredPackets returns the total amount of packets queued by all sessions.
+	DeferredPackets() int
+}
+
+// sessionCollector collects the metrics of the sessions currently connected when the metrics are scraped.
+type sessionCollector struct {
+	src SessionSource
+}
+
+// RegisterSessions registers the metrics of the sessions provided by the source passed.
+func RegisterSessions(src SessionSource) {
+	Registry.MustRegister(sessionCollector{src: src})
+}
+
+func (c sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+	ch <- deferredPacketsDesc
+}
+
+func (c sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	for tenant, n := range c.src.TenantCounts() {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(n), tenant)
+	}
+	ch <- prometheus.MustNewConstMetric(deferredPacketsDesc, prometheus.GaugeValue, float64(c.src.DeferredPackets()))
+}
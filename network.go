@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/certauth"
 	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/metrics"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
 	"github.com/quic-go/quic-go"
 )
 
-func handleConn(conn quic.Connection) {
+// handleConn accepts streams from the connection passed until the context passed is cancelled, creating a
+// client for every stream.
+func handleConn(ctx context.Context, conn quic.Connection) {
 	defer func() {
 		if v := recover(); v != nil {
 			hub := sentry.CurrentHub().Clone()
@@ -21,9 +27,33 @@ func handleConn(conn quic.Connection) {
 		}
 	}()
 
+	metrics.ConnectionsAccepted.Inc()
+	var streams int
+	defer func() {
+		metrics.StreamsPerConnection.Observe(float64(streams))
+	}()
+
+	// The client certificate is verified during the handshake, so any certificate presented here is trusted.
+	certID, hasCert, err := certauth.FromConnectionState(conn.ConnectionState().TLS)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("addr", conn.RemoteAddr().String()).
+			Msg("unable to derive proxy identity from client certificate")
+	}
+
 	// Start listening and accepting streams from the connection.
 	for {
-		stream, err := conn.AcceptStream(context.Background())
+		stream, err := conn.AcceptStream(ctx)
+		if ctx.Err() != nil {
+			// The server is shutting down, so streams are no longer accepted. The connection is closed once all
+			// clients are disconnected.
+			if err == nil {
+				stream.CancelRead(0)
+				stream.CancelWrite(0)
+			}
+			return
+		}
 		if err != nil {
 			logger.Error().
 				Err(err).
@@ -32,14 +62,31 @@ func handleConn(conn quic.Connection) {
 			return
 		}
 
-		c := client.New(stream, conn.RemoteAddr(), logger)
-		c.RegisterHandlers(handler.NewAuthenticationHandler(c), handler.NewOomphRecorder(c))
+		streams++
+		metrics.StreamsAccepted.Inc()
 
-		// TODO: Should we be storing this client somewhere?
+		c := client.New(stream, conn.RemoteAddr(), logger, *clientCfg.Load())
+		if hasCert {
+			c.SetCertificateIdentity(certID)
+		}
+		c.RegisterHandlers(
+			handler.NewHandshakeHandler(c),
+			handler.NewAuthenticationHandler(c, authMode, revocations, tenants),
+			handler.NewPlayerInfoHandler(c),
+			handler.NewOomphRecorder(c, cfg.Load().Storage.RecordingDir, sessions, tenants),
+		)
+		clients.Add(c)
+		if ctx.Err() != nil {
+			// The server started shutting down while the client was being created, possibly after all clients
+			// were already disconnected.
+			_ = c.Disconnect(cloudpacket.DisconnectReasonServerShutdown, "server shutting down")
+		}
 	}
 }
 
-func listen(l *quic.Listener) {
+// listen accepts connections from the listener passed until it is closed. Connections accepted stop accepting
+// streams once the context passed is cancelled.
+func listen(ctx context.Context, l *quic.Listener) {
 	defer func() {
 		if v := recover(); v != nil {
 			hub := sentry.CurrentHub().Clone()
@@ -49,12 +96,15 @@ func listen(l *quic.Listener) {
 		}
 	}()
 
-	ctx := context.Background()
 	for {
-		if conn, err := l.Accept(ctx); err == nil {
-			go handleConn(conn)
-		} else {
+		conn, err := l.Accept(ctx)
+		if errors.Is(err, quic.ErrServerClosed) || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
 			logger.Error().Err(err).Msg("failed to accept connection")
+			continue
 		}
+		go handleConn(ctx, conn)
 	}
 }
@@ -0,0 +1,52 @@
+package packet
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// AuthenticateResponse is sent by the server in response to an Authenticate packet, letting the proxy know if
+// the authentication succeeded and which limits it should adhere to for the rest of the session.
+type AuthenticateResponse struct {
+	// Success is true if the proxy was authenticated. If false, the stream is closed after the packet is sent.
+	Success bool
+	// SessionID is the unique identifier assigned by the server to the session.
+	SessionID uuid.UUID
+	// Tenant is the tenant resolved from the token the proxy authenticated with.
+	Tenant string
+	// MaxBatchSize is the maximum size of a batch, in bytes, that the proxy may send.
+	MaxBatchSize uint32
+	// FlushInterval is the interval at which the server flushes packets to the proxy.
+	FlushInterval time.Duration
+	// TokenExpiry is the time at which the token the proxy authenticated with expires. It is zero if the token
+	// does not expire.
+	TokenExpiry time.Time
+}
+
+func (*AuthenticateResponse) ID() uint32 {
+	return IDAuthenticateResponse
+}
+
+func (pk *AuthenticateResponse) Marshal(io protocol.IO) {
+	io.Bool(&pk.Success)
+	io.UUID(&pk.SessionID)
+	io.String(&pk.Tenant)
+	io.Uint32(&pk.MaxBatchSize)
+
+	flushInterval := pk.FlushInterval.Milliseconds()
+	io.Varint64(&flushInterval)
+	pk.FlushInterval = time.Duration(flushInterval) * time.Millisecond
+
+	var expiry int64
+	if !pk.TokenExpiry.IsZero() {
+		expiry = pk.TokenExpiry.Unix()
+	}
+	io.Varint64(&expiry)
+	if expiry != 0 {
+		pk.TokenExpiry = time.Unix(expiry, 0)
+	} else {
+		pk.TokenExpiry = time.Time{}
+	}
+}
@@ -0,0 +1,59 @@
+package packet
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// Detection is a packet sent by the proxy when Oomph flags a player. It allows sessions to be investigated for
+// false positives by looking at the packets surrounding each flag.
+type Detection struct {
+	// Type is the type of the detection that flagged, such as "Reach".
+	Type string
+	// SubType is the sub-type of the detection that flagged, such as "A".
+	SubType string
+	// Violations is the violation level of the detection after the flag.
+	Violations float32
+	// Tick is the tick of the player at which the detection flagged.
+	Tick uint64
+	// Data is free-form debug data provided by the detection.
+	Data map[string]string
+}
+
+func (*Detection) ID() uint32 {
+	return IDDetection
+}
+
+func (pk *Detection) Marshal(io protocol.IO) {
+	io.String(&pk.Type)
+	io.String(&pk.SubType)
+	io.Float32(&pk.Violations)
+	io.Varuint64(&pk.Tick)
+
+	// The data is encoded as a list of key/value pairs, as protocol.IO has no support for maps. The pairs are
+	// sorted by key, so that the same packet is always encoded the same way.
+	pairs := make([]debugPair, 0, len(pk.Data))
+	for _, k := range slices.Sorted(maps.Keys(pk.Data)) {
+		pairs = append(pairs, debugPair{Key: k, Value: pk.Data[k]})
+	}
+	protocol.Slice(io, &pairs)
+	if len(pairs) > 0 && pk.Data == nil {
+		pk.Data = make(map[string]string, len(pairs))
+	}
+	for _, pair := range pairs {
+		pk.Data[pair.Key] = pair.Value
+	}
+}
+
+// debugPair is a key/value pair in the debug data of a Detection packet.
+type debugPair struct {
+	Key   string
+	Value string
+}
+
+func (p *debugPair) Marshal(io protocol.IO) {
+	io.String(&p.Key)
+	io.String(&p.Value)
+}
@@ -0,0 +1,34 @@
+package packet_test
+
+import (
+	"bytes"
+	"maps"
+	"testing"
+
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+func TestDetectionDeterministic(t *testing.T) {
+	pk := &cloudpacket.Detection{Type: "Reach", SubType: "A", Tick: 20, Data: map[string]string{
+		"distance": "3.2", "yaw": "90", "pitch": "0", "ping": "50", "ticks": "2",
+	}}
+	encode := func() []byte {
+		buf := bytes.NewBuffer(nil)
+		pk.Marshal(protocol.NewWriter(buf, 0))
+		return buf.Bytes()
+	}
+
+	data := encode()
+	for range 10 {
+		if !bytes.Equal(encode(), data) {
+			t.Fatal("expected detection to be encoded the same way every time")
+		}
+	}
+
+	decoded := &cloudpacket.Detection{}
+	decoded.Marshal(protocol.NewReader(bytes.NewBuffer(data), 0, false))
+	if decoded.Type != pk.Type || decoded.Tick != pk.Tick || !maps.Equal(decoded.Data, pk.Data) {
+		t.Errorf("expected %+v, got %+v", pk, decoded)
+	}
+}
@@ -0,0 +1,52 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+const (
+	// DisconnectReasonUnknown is used when the reason of a disconnect is not covered by any other reason.
+	DisconnectReasonUnknown byte = iota
+	// DisconnectReasonServerShutdown is used when the server is shutting down.
+	DisconnectReasonServerShutdown
+	// DisconnectReasonIncompatibleProtocol is used when the handshake with the proxy failed, because the proxy
+	// does not support any protocol or features supported by the server.
+	DisconnectReasonIncompatibleProtocol
+	// DisconnectReasonAuthenticationFailed is used when the proxy could not be authenticated.
+	DisconnectReasonAuthenticationFailed
+	// DisconnectReasonUnknownPacket is used when the proxy sent a packet with an ID unknown to the server.
+	DisconnectReasonUnknownPacket
+	// DisconnectReasonInvalidBatch is used when the proxy sent a batch that was malformed or too large.
+	DisconnectReasonInvalidBatch
+	// DisconnectReasonProtocolViolation is used when the proxy sent a packet that was not expected.
+	DisconnectReasonProtocolViolation
+	// DisconnectReasonInternalError is used when the server failed to process a packet due to an error on
+	// the server's side.
+	DisconnectReasonInternalError
+	// DisconnectReasonTokenRevoked is used when the token the proxy authenticated with was revoked.
+	DisconnectReasonTokenRevoked
+	// DisconnectReasonTokenExpired is used when the token the proxy authenticated with expired, without the
+	// proxy re-authenticating with a fresh token.
+	DisconnectReasonTokenExpired
+	// DisconnectReasonQuotaExceeded is used when the tenant of the proxy exceeded one of the limits of its
+	// policy, such as its storage quota, maximum session length or maximum amount of concurrent streams.
+	DisconnectReasonQuotaExceeded
+	// DisconnectReasonKicked is used when an administrator forcibly disconnected the proxy.
+	DisconnectReasonKicked
+)
+
+// Disconnect is sent by the server right before it closes the stream, to let the proxy know why it was
+// disconnected.
+type Disconnect struct {
+	// Reason is the reason the proxy was disconnected. It is one of the constants above.
+	Reason byte
+	// Message is a human-readable message describing why the proxy was disconnected.
+	Message string
+}
+
+func (*Disconnect) ID() uint32 {
+	return IDDisconnect
+}
+
+func (pk *Disconnect) Marshal(io protocol.IO) {
+	io.Uint8(&pk.Reason)
+	io.String(&pk.Message)
+}
@@ -0,0 +1,78 @@
+package packet
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// DirectionServerbound is the direction of a game packet sent by the player to the server.
+	DirectionServerbound byte = iota
+	// DirectionClientbound is the direction of a game packet sent by the server to the player.
+	DirectionClientbound
+)
+
+var (
+	serverboundPool = packet.NewClientPool()
+	clientboundPool = packet.NewServerPool()
+)
+
+// GamePacket is a single Minecraft packet forwarded by the proxy, sent either by the player or by the server.
+type GamePacket struct {
+	// Direction is the direction the packet was sent in. It is either DirectionServerbound or DirectionClientbound.
+	Direction byte
+	// Tick is the tick of the player at which the packet was sent.
+	Tick uint64
+	// PacketID is the ID of the Minecraft packet.
+	PacketID uint32
+	// Payload is the encoded Minecraft packet, excluding its header.
+	Payload []byte
+}
+
+// Marshal encodes/decodes the game packet using the IO passed.
+func (pk *GamePacket) Marshal(io protocol.IO) {
+	io.Uint8(&pk.Direction)
+	io.Varuint64(&pk.Tick)
+	io.Varuint32(&pk.PacketID)
+	io.ByteSlice(&pk.Payload)
+}
+
+// Decode decodes the payload of the game packet into a Minecraft packet. The shield ID passed must be the
+// shield ID of the session the packet was sent in, as it is required to decode items.
+func (pk *GamePacket) Decode(shieldID int32) (decoded packet.Packet, err error) {
+	pool := serverboundPool
+	if pk.Direction == DirectionClientbound {
+		pool = clientboundPool
+	}
+	f, ok := pool[pk.PacketID]
+	if !ok {
+		return nil, fmt.Errorf("unknown game packet ID %d", pk.PacketID)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("failed to decode game packet %d: %v", pk.PacketID, v)
+		}
+	}()
+	decoded = f()
+	decoded.Marshal(protocol.NewReader(bytes.NewBuffer(pk.Payload), shieldID, false))
+	return decoded, nil
+}
+
+// GamePackets is a packet sent by the proxy containing a batch of Minecraft packets sent between the player and
+// the server, allowing the gameplay of the player to be recorded.
+type GamePackets struct {
+	// Packets is the list of game packets in the batch, ordered by the time they were sent.
+	Packets []GamePacket
+}
+
+func (*GamePackets) ID() uint32 {
+	return IDGamePackets
+}
+
+func (pk *GamePackets) Marshal(io protocol.IO) {
+	protocol.Slice(io, &pk.Packets)
+}
@@ -0,0 +1,55 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// Hello is the first packet sent by a proxy after opening a stream. It advertises the protocol versions and
+// features supported by the proxy, which the server responds to with a ServerHello.
+type Hello struct {
+	// ProtocolVersion is the version of the oCloud protocol the proxy implements.
+	ProtocolVersion uint32
+	// MinecraftProtocol is the Minecraft protocol version of the game packets forwarded by the proxy.
+	MinecraftProtocol int32
+	// Compression is the list of compression algorithms supported by the proxy, in order of preference.
+	Compression []byte
+	// Packets is the list of IDs of the packets the proxy may send.
+	Packets []uint32
+}
+
+func (*Hello) ID() uint32 {
+	return IDHello
+}
+
+func (pk *Hello) Marshal(io protocol.IO) {
+	io.Varuint32(&pk.ProtocolVersion)
+	io.Varint32(&pk.MinecraftProtocol)
+	io.ByteSlice(&pk.Compression)
+	protocol.FuncSlice(io, &pk.Packets, io.Varuint32)
+}
+
+// ServerHello is sent by the server in response to a Hello packet. It either accepts the proxy with the options
+// chosen by the server, or rejects it with a reason.
+type ServerHello struct {
+	// Accepted is true if the server accepted the proxy. If false, the stream is closed after the packet is sent.
+	Accepted bool
+	// Reason is the reason the proxy was rejected. It is empty if the proxy was accepted.
+	Reason string
+	// ProtocolVersion is the version of the oCloud protocol the server implements.
+	ProtocolVersion uint32
+	// Compression is the compression algorithm chosen by the server.
+	Compression byte
+	// Packets is the list of IDs of the packets, advertised by the proxy, that the server is able to handle. The
+	// proxy is disconnected if it sends any other packet after the handshake.
+	Packets []uint32
+}
+
+func (*ServerHello) ID() uint32 {
+	return IDServerHello
+}
+
+func (pk *ServerHello) Marshal(io protocol.IO) {
+	io.Bool(&pk.Accepted)
+	io.String(&pk.Reason)
+	io.Varuint32(&pk.ProtocolVersion)
+	io.Uint8(&pk.Compression)
+	protocol.FuncSlice(io, &pk.Packets, io.Varuint32)
+}
@@ -27,8 +27,8 @@ func (pk *PlayerInfo) Marshal(io protocol.IO) {
 	hasIdentityData := len(pk.IdentityData) > 0
 	io.Bool(&hasIdentityData)
 	if hasIdentityData {
-		io.Bytes(&pk.IdentityData)
+		io.ByteSlice(&pk.IdentityData)
 	}
-	io.Bytes(&pk.ClientData)
+	io.ByteSlice(&pk.ClientData)
 	io.Vec3(&pk.PlayerPosition)
 }
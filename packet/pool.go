@@ -1,16 +1,34 @@
 package packet
 
-import "github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+import (
+	"fmt"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
 
 const (
 	IDAuthenticate uint32 = iota
 	IDPlayerInfo
+	IDGamePackets
+	IDDetection
+	IDHello
+	IDServerHello
+	IDDisconnect
+	IDAuthenticateResponse
 )
 
 var pool = make(map[uint32]func() packet.Packet)
 
 func init() {
 	Register(func() packet.Packet { return &Authenticate{} })
+	Register(func() packet.Packet { return &PlayerInfo{} })
+	Register(func() packet.Packet { return &GamePackets{} })
+	Register(func() packet.Packet { return &Detection{} })
+	Register(func() packet.Packet { return &Hello{} })
+	Register(func() packet.Packet { return &ServerHello{} })
+	Register(func() packet.Packet { return &Disconnect{} })
+	Register(func() packet.Packet { return &AuthenticateResponse{} })
 }
 
 func Register(pkFunc func() packet.Packet) {
@@ -18,9 +36,29 @@ func Register(pkFunc func() packet.Packet) {
 	pool[pk.ID()] = pkFunc
 }
 
+// Registered returns true if a packet is registered with the ID passed.
+func Registered(id uint32) bool {
+	_, ok := pool[id]
+	return ok
+}
+
 func Find(id uint32) packet.Packet {
 	if f, ok := pool[id]; ok {
 		return f()
 	}
 	return nil
 }
+
+// Decode reads a packet ID from the reader passed and decodes the packet registered with it. An error is returned
+// if no packet is registered with the ID. Like the protocol.Reader, Decode panics if the data read is invalid.
+func Decode(r *protocol.Reader) (packet.Packet, error) {
+	var packetId uint32
+	r.Uint32(&packetId)
+
+	pk := Find(packetId)
+	if pk == nil {
+		return nil, fmt.Errorf("unknown packet ID %d", packetId)
+	}
+	pk.Marshal(r)
+	return pk, nil
+}
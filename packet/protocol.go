@@ -0,0 +1,10 @@
+package packet
+
+// ProtocolVersion is the version of the oCloud protocol implemented by this package. It is incremented whenever
+// the layout of a packet changes.
+const ProtocolVersion uint32 = 1
+
+const (
+	// CompressionZlib is the compression algorithm used to compress batches with zlib.
+	CompressionZlib byte = iota
+)
@@ -0,0 +1,31 @@
+// Package recording implements the on-disk container format used to store sessions recorded by oCloud.
+//
+// A recording is laid out as follows. All fixed-width integers are little-endian.
+//
+//	preamble   magic "OCRF" (4 bytes), version (uint16), compression algorithm (uint8)
+//	header     Header, encoded using a protocol.Writer
+//	chunk*     zero or more chunks containing the recorded packets, optionally interleaved with metadata blocks
+//	index      a single index block, only present if the recording was finalized
+//	trailer    offset of the index block (uint64), magic "OCRI" (4 bytes)
+//
+// Chunks and the index are both stored as blocks:
+//
+//	type       block type (uint8)
+//	length     length of the payload (uint32)
+//	checksum   CRC-32 (IEEE) of the payload (uint32)
+//	payload    the contents of the block
+//
+// The payload of a chunk starts with an uncompressed ChunkInfo, describing the time range, amount of packets,
+// range of ticks of the player and the flags of Oomph detections in the chunk, followed by the compressed
+// entries. Each entry is the time offset in nanoseconds since Header.StartTime (varint64) followed by the packet
+// (byte slice, prefixed by a varuint32 length), encoded as the packet ID (uint32) and the packet itself.
+//
+// The payload of a metadata block is Metadata encoded as JSON. Metadata may change during a session, in which
+// case a new metadata block is written and the last one in the recording takes precedence.
+//
+// The payload of the index is a list of IndexEntry, mapping the time and tick range of every chunk to its offset
+// in the file, allowing readers to seek to any point or tick of a recording without decoding it entirely, followed
+// by the latest metadata (byte slice, prefixed by a varuint32 length). If a recording was not finalized (for
+// example because the server crashed), the index and trailer are absent. In that case the index is rebuilt by
+// scanning the chunks, stopping at the first incomplete chunk.
+package recording
@@ -0,0 +1,328 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// Entry is a single packet stored in a chunk of a recording.
+type Entry struct {
+	// Offset is the time at which the packet was received, relative to the start of the recording.
+	Offset time.Duration
+	// Payload is the encoded packet, consisting of the packet ID followed by the packet itself.
+	Payload []byte
+}
+
+// File is a recording opened for reading. The index of the file is loaded when it is opened, allowing chunks
+// to be read in any order.
+type File struct {
+	r      io.ReaderAt
+	closer io.Closer
+
+	version     uint16
+	compression byte
+	hdr         Header
+	meta        Metadata
+
+	index     []IndexEntry
+	finalized bool
+}
+
+// Open opens the recording at the path passed and loads its index.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %v", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to stat recording: %v", err)
+	}
+
+	file, err := NewFile(f, stat.Size())
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	file.closer = f
+	return file, nil
+}
+
+// NewFile reads a recording of the size passed from r and loads its index. If the recording was not finalized,
+// the index is rebuilt from the chunks that were completely written.
+func NewFile(r io.ReaderAt, size int64) (*File, error) {
+	file := &File{r: r}
+
+	var preamble [preambleSize]byte
+	if _, err := r.ReadAt(preamble[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read preamble: %v", err)
+	}
+	if !bytes.Equal(preamble[:4], magic[:]) {
+		return nil, fmt.Errorf("not a recording: invalid magic %x", preamble[:4])
+	}
+	file.version = binary.LittleEndian.Uint16(preamble[4:6])
+	file.compression = preamble[6]
+	if file.version != Version {
+		return nil, fmt.Errorf("unsupported recording version %d", file.version)
+	}
+	if file.compression != CompressionZlib {
+		return nil, fmt.Errorf("unsupported compression algorithm %d", file.compression)
+	}
+
+	hdrReader := &countingReader{r: bufio.NewReader(io.NewSectionReader(r, preambleSize, size-preambleSize))}
+	if err := unmarshal(hdrReader, &file.hdr); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	dataOffset := preambleSize + hdrReader.n
+
+	if err := file.readIndex(size); err != nil {
+		file.scanIndex(dataOffset, size)
+	}
+	return file, nil
+}
+
+// Header returns the header of the recording.
+func (f *File) Header() Header {
+	return f.hdr
+}
+
+// Metadata returns the latest metadata written to the recording.
+func (f *File) Metadata() Metadata {
+	return f.meta
+}
+
+// Index returns the index of the recording, with an entry for every chunk ordered by time.
+func (f *File) Index() []IndexEntry {
+	return f.index
+}
+
+// Finalized returns true if the recording was finalized by the writer. If false, the recording was likely
+// interrupted and only contains the chunks that were completely written.
+func (f *File) Finalized() bool {
+	return f.finalized
+}
+
+// Flags returns the timeline of flags of the recording, ordered by time.
+func (f *File) Flags() []Flag {
+	var flags []Flag
+	for _, entry := range f.index {
+		flags = append(flags, entry.Flags...)
+	}
+	return flags
+}
+
+// Duration returns the time between the start of the recording and the last packet recorded.
+func (f *File) Duration() time.Duration {
+	if len(f.index) == 0 {
+		return 0
+	}
+	return f.index[len(f.index)-1].End
+}
+
+// ReadChunk reads and decompresses the chunk pointed to by the index entry passed, returning all entries it
+// contains.
+func (f *File) ReadChunk(entry IndexEntry) ([]Entry, error) {
+	blockType, payload, err := readBlock(io.NewSectionReader(f.r, entry.Offset, math.MaxInt64-entry.Offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %v", err)
+	}
+	if blockType != blockTypeChunk {
+		return nil, fmt.Errorf("expected chunk at offset %d, got block type %d", entry.Offset, blockType)
+	}
+
+	buf := bytes.NewReader(payload)
+	var info ChunkInfo
+	if err := unmarshal(buf, &info); err != nil {
+		return nil, fmt.Errorf("failed to read chunk info: %v", err)
+	}
+	decompressor, err := zlib.NewReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress chunk: %v", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(decompressor, maxBlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress chunk: %v", err)
+	}
+	if len(data) > maxBlockSize {
+		return nil, fmt.Errorf("decompressed chunk exceeds %d bytes", maxBlockSize)
+	}
+	// The amount of packets is read from the file, so it is checked against the data present before any entries
+	// are allocated.
+	if uint64(info.Packets)*minEntrySize > uint64(len(data)) {
+		return nil, fmt.Errorf("chunk of %d bytes cannot hold %d packets", len(data), info.Packets)
+	}
+
+	entries := make([]Entry, info.Packets)
+	for i := range entries {
+		if entries[i], data, err = readEntry(data); err != nil {
+			return nil, fmt.Errorf("failed to read entry %d of chunk: %v", i, err)
+		}
+	}
+	return entries, nil
+}
+
+// readEntry reads a single entry from the decompressed data of a chunk, returning the entry and the data
+// following it. The payload of the entry references the data passed. Unlike Entry.Marshal, the length of the
+// payload is checked against the data left before it is read.
+func readEntry(data []byte) (Entry, []byte, error) {
+	offset, n := binary.Varint(data)
+	if n <= 0 {
+		return Entry{}, nil, fmt.Errorf("invalid offset")
+	}
+	data = data[n:]
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return Entry{}, nil, fmt.Errorf("invalid payload length")
+	}
+	end := n + int(length)
+	return Entry{Offset: time.Duration(offset), Payload: data[n:end:end]}, data[end:], nil
+}
+
+// Close closes the underlying file of the recording, if it was opened using Open.
+func (f *File) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+// Marshal encodes/decodes the entry using the IO passed.
+func (entry *Entry) Marshal(io protocol.IO) {
+	offset := int64(entry.Offset)
+	io.Varint64(&offset)
+	io.ByteSlice(&entry.Payload)
+	entry.Offset = time.Duration(offset)
+}
+
+// readIndex reads the index pointed to by the trailer of the recording. An error is returned if the recording
+// has no valid trailer or index.
+func (f *File) readIndex(size int64) error {
+	if size < preambleSize+trailerSize {
+		return fmt.Errorf("recording too small to contain trailer")
+	}
+	var trailer [trailerSize]byte
+	if _, err := f.r.ReadAt(trailer[:], size-trailerSize); err != nil {
+		return err
+	}
+	if !bytes.Equal(trailer[8:], indexMagic[:]) {
+		return fmt.Errorf("recording has no trailer")
+	}
+
+	offset := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	if offset < preambleSize || offset >= size-trailerSize {
+		return fmt.Errorf("invalid index offset %d", offset)
+	}
+	blockType, payload, err := readBlock(io.NewSectionReader(f.r, offset, size-trailerSize-offset))
+	if err != nil {
+		return err
+	}
+	if blockType != blockTypeIndex {
+		return fmt.Errorf("expected index at offset %d, got block type %d", offset, blockType)
+	}
+
+	var (
+		index []IndexEntry
+		meta  []byte
+	)
+	if err := unmarshal(bytes.NewReader(payload), &indexBlock{entries: &index, meta: &meta}); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(meta, &f.meta); err != nil {
+		return fmt.Errorf("failed to decode metadata: %v", err)
+	}
+	f.index, f.finalized = index, true
+	return nil
+}
+
+// scanIndex rebuilds the index and metadata of the recording by reading every block from the offset passed.
+// Scanning stops at the first block that is incomplete or corrupted.
+func (f *File) scanIndex(offset, size int64) {
+	r := bufio.NewReader(io.NewSectionReader(f.r, offset, size-offset))
+	for {
+		blockType, payload, err := readBlock(r)
+		if err != nil {
+			return
+		}
+
+		switch blockType {
+		case blockTypeChunk:
+			entry := IndexEntry{Offset: offset}
+			if err := unmarshal(bytes.NewReader(payload), &entry.ChunkInfo); err != nil {
+				return
+			}
+			f.index = append(f.index, entry)
+		case blockTypeMetadata:
+			var meta Metadata
+			if err := json.Unmarshal(payload, &meta); err != nil {
+				return
+			}
+			f.meta = meta
+		default:
+			return
+		}
+		offset += int64(blockHeaderSize + len(payload))
+	}
+}
+
+// indexBlock wraps the contents of an index block so that it may be decoded using unmarshal.
+type indexBlock struct {
+	entries *[]IndexEntry
+	meta    *[]byte
+}
+
+// Marshal encodes/decodes the index block using the IO passed.
+func (b *indexBlock) Marshal(io protocol.IO) {
+	protocol.Slice(io, b.entries)
+	io.ByteSlice(b.meta)
+}
+
+// unmarshal decodes m from the reader passed, returning an error instead of panicking if the data is invalid.
+func unmarshal(r interface {
+	io.Reader
+	io.ByteReader
+}, m protocol.Marshaler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if e, ok := v.(error); ok && errors.Is(e, io.EOF) {
+				err = io.ErrUnexpectedEOF
+				return
+			}
+			err = fmt.Errorf("%v", v)
+		}
+	}()
+	m.Marshal(protocol.NewReader(r, 0, false))
+	return nil
+}
+
+// countingReader wraps a bufio.Reader and counts the amount of bytes read from it.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+// Read reads exactly len(p) bytes, as the protocol.Reader expects reads to never be short.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(c.r, p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
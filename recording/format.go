@@ -0,0 +1,203 @@
+package recording
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Version is the current version of the recording format written by Writer.
+const Version uint16 = 1
+
+const (
+	// CompressionZlib is the compression algorithm used to compress chunks with zlib.
+	CompressionZlib byte = iota
+)
+
+const (
+	// blockTypeChunk is the block type of a chunk containing recorded packets.
+	blockTypeChunk byte = iota + 1
+	// blockTypeIndex is the block type of the index written when the recording is finalized.
+	blockTypeIndex
+	// blockTypeMetadata is the block type of the metadata of the recording. It may be written at any point
+	// between chunks, with the last metadata block in the recording taking precedence.
+	blockTypeMetadata
+)
+
+const (
+	// preambleSize is the size of the preamble at the start of every recording.
+	preambleSize = 7
+	// blockHeaderSize is the size of the header preceding the payload of every block.
+	blockHeaderSize = 9
+	// trailerSize is the size of the trailer at the end of a finalized recording.
+	trailerSize = 12
+	// maxBlockSize is the maximum size of a block payload accepted when reading a recording. It also limits the
+	// size of the decompressed entries of a chunk.
+	maxBlockSize = 64 * 1024 * 1024
+	// maxPacketSize is the maximum size of a single packet written to a recording. A chunk is written once its
+	// entries exceed MaxChunkSize, so the entries of a chunk never exceed maxBlockSize.
+	maxPacketSize = maxBlockSize - MaxChunkSize
+	// minEntrySize is the minimum size of an encoded entry: a single byte for both the offset and the length
+	// of the packet.
+	minEntrySize = 2
+)
+
+var (
+	// magic is the sequence of bytes every recording starts with.
+	magic = [4]byte{'O', 'C', 'R', 'F'}
+	// indexMagic is the sequence of bytes every finalized recording ends with.
+	indexMagic = [4]byte{'O', 'C', 'R', 'I'}
+)
+
+// Metadata holds information about a recorded session that only becomes known after the recording was
+// started, such as the identity of the player. It is stored as JSON, so that fields may be added without
+// breaking existing recordings.
+type Metadata struct {
+	// Tenant is the ID of the network the session was recorded for.
+	Tenant string `json:"tenant,omitempty"`
+	// Proxy is the ID of the proxy the session was recorded from.
+	Proxy string `json:"proxy,omitempty"`
+	// ShieldID is the runtime ID of the shield item, required to decode items in the recorded packets.
+	ShieldID int32 `json:"shield_id"`
+	// XUID is the XBOX Live user ID of the player.
+	XUID string `json:"xuid,omitempty"`
+	// PlayerUUID is the identity UUID of the player.
+	PlayerUUID string `json:"player_uuid,omitempty"`
+	// DisplayName is the gamertag of the player.
+	DisplayName string `json:"display_name,omitempty"`
+	// DeviceOS is the operating system of the device the player is playing on.
+	DeviceOS int32 `json:"device_os"`
+	// ClientVersion is the version of the game the player is playing on.
+	ClientVersion string `json:"client_version,omitempty"`
+}
+
+// ChunkInfo describes the contents of a chunk. It is stored uncompressed at the start of every chunk, so
+// that the index may be rebuilt without decompressing the chunks.
+type ChunkInfo struct {
+	// Start is the offset of the first packet in the chunk since the start of the recording.
+	Start time.Duration
+	// End is the offset of the last packet in the chunk since the start of the recording.
+	End time.Duration
+	// Packets is the amount of packets stored in the chunk.
+	Packets uint32
+	// Ticked is true if any packet or flag in the chunk carried a tick of the player. If false, MinTick and
+	// MaxTick are always 0.
+	Ticked bool
+	// MinTick and MaxTick are the lowest and highest tick of the player carried by the packets and flags in the
+	// chunk. The ticks of packets are read from GamePackets and Detection packets.
+	MinTick, MaxTick uint64
+	// Flags is the list of flags that occurred during the time range of the chunk.
+	Flags []Flag
+}
+
+// Marshal encodes/decodes the chunk info using the IO passed.
+func (info *ChunkInfo) Marshal(io protocol.IO) {
+	start, end := int64(info.Start), int64(info.End)
+	io.Varint64(&start)
+	io.Varint64(&end)
+	io.Varuint32(&info.Packets)
+	io.Bool(&info.Ticked)
+	io.Varuint64(&info.MinTick)
+	io.Varuint64(&info.MaxTick)
+	protocol.Slice(io, &info.Flags)
+	info.Start, info.End = time.Duration(start), time.Duration(end)
+}
+
+// Ticks returns the lowest and highest tick of the player carried by the packet passed. False is returned if the
+// packet carries no ticks, which is the case for every packet other than GamePackets and Detection.
+func Ticks(pk packet.Packet) (low, high uint64, ok bool) {
+	switch pk := pk.(type) {
+	case *cloudpacket.GamePackets:
+		if len(pk.Packets) == 0 {
+			return 0, 0, false
+		}
+		low, high = pk.Packets[0].Tick, pk.Packets[0].Tick
+		for _, gamePacket := range pk.Packets[1:] {
+			low, high = min(low, gamePacket.Tick), max(high, gamePacket.Tick)
+		}
+		return low, high, true
+	case *cloudpacket.Detection:
+		return pk.Tick, pk.Tick, true
+	}
+	return 0, 0, false
+}
+
+// Flag is a flag of an Oomph detection that occurred during a recorded session. Flags are stored in the chunk
+// info, so that the timeline of flags of a recording can be read without decoding any packets.
+type Flag struct {
+	// Offset is the time at which the flag occurred, relative to the start of the recording.
+	Offset time.Duration
+	// Tick is the tick of the player at which the flag occurred.
+	Tick uint64
+	// Type is the type of the detection that flagged.
+	Type string
+	// SubType is the sub-type of the detection that flagged.
+	SubType string
+	// Violations is the violation level of the detection after the flag.
+	Violations float32
+}
+
+// Marshal encodes/decodes the flag using the IO passed.
+func (flag *Flag) Marshal(io protocol.IO) {
+	offset := int64(flag.Offset)
+	io.Varint64(&offset)
+	io.Varuint64(&flag.Tick)
+	io.String(&flag.Type)
+	io.String(&flag.SubType)
+	io.Float32(&flag.Violations)
+	flag.Offset = time.Duration(offset)
+}
+
+// IndexEntry is an entry in the index of a recording, pointing to a single chunk.
+type IndexEntry struct {
+	ChunkInfo
+	// Offset is the offset of the chunk block in the recording.
+	Offset int64
+}
+
+// Marshal encodes/decodes the index entry using the IO passed.
+func (entry *IndexEntry) Marshal(io protocol.IO) {
+	entry.ChunkInfo.Marshal(io)
+	io.Varint64(&entry.Offset)
+}
+
+// writeBlock writes a block with the type and payload passed to w.
+func writeBlock(w io.Writer, blockType byte, payload []byte) error {
+	var hdr [blockHeaderSize]byte
+	hdr[0] = blockType
+	binary.LittleEndian.PutUint32(hdr[1:5], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[5:9], crc32.ChecksumIEEE(payload))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readBlock reads a block from r, returning its type and payload. An error is returned if the block is
+// incomplete or its checksum does not match.
+func readBlock(r io.Reader) (byte, []byte, error) {
+	var hdr [blockHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.LittleEndian.Uint32(hdr[1:5])
+	if length > maxBlockSize {
+		return 0, nil, fmt.Errorf("block length %d exceeds maximum of %d", length, maxBlockSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(hdr[5:9]) {
+		return 0, nil, fmt.Errorf("block checksum mismatch")
+	}
+	return hdr[0], payload, nil
+}
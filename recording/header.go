@@ -0,0 +1,33 @@
+package recording
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// Header is the metadata written at the start of every recording. It describes the session the
+// recording belongs to.
+type Header struct {
+	// SessionID is the unique identifier of the session that was recorded.
+	SessionID uuid.UUID
+	// StartTime is the time at which the recording was started.
+	StartTime time.Time
+	// RemoteAddr is the network address of the proxy that the session was recorded from.
+	RemoteAddr string
+	// ProtocolVersion is the Minecraft protocol version the recorded packets were encoded with.
+	ProtocolVersion int32
+}
+
+// Marshal encodes/decodes the header using the IO passed.
+func (h *Header) Marshal(io protocol.IO) {
+	io.UUID(&h.SessionID)
+
+	startTime := h.StartTime.UnixNano()
+	io.Int64(&startTime)
+	h.StartTime = time.Unix(0, startTime)
+
+	io.String(&h.RemoteAddr)
+	io.Int32(&h.ProtocolVersion)
+}
@@ -0,0 +1,320 @@
+package recording
+
+import (
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// create creates a recording in a temporary directory, returning its writer and path.
+func create(t *testing.T) (*Writer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session.ocr")
+	w, err := Create(path, Header{
+		SessionID:       uuid.New(),
+		StartTime:       start,
+		RemoteAddr:      "127.0.0.1:19132",
+		ProtocolVersion: protocol.CurrentProtocol,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetMetadata(Metadata{Tenant: "network", ShieldID: 355, DisplayName: "Steve"}); err != nil {
+		t.Fatal(err)
+	}
+	return w, path
+}
+
+// writeDetections writes a Detection packet at every offset passed, with the tick of the detection set to the
+// index of the offset.
+func writeDetections(t *testing.T, w *Writer, offsets ...time.Duration) {
+	t.Helper()
+	for i, offset := range offsets {
+		if err := w.WritePacket(start.Add(offset), &cloudpacket.Detection{Type: "Reach", SubType: "A", Tick: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTicks reads every chunk in the index of the recording and returns the ticks of the Detection packets
+// in it.
+func readTicks(t *testing.T, f *File) []uint64 {
+	t.Helper()
+	var ticks []uint64
+	for _, entry := range f.Index() {
+		entries, err := f.ReadChunk(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			pk, err := cloudpacket.Decode(protocol.NewReader(bytes.NewBuffer(e.Payload), f.Metadata().ShieldID, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ticks = append(ticks, pk.(*cloudpacket.Detection).Tick)
+		}
+	}
+	return ticks
+}
+
+func TestRoundTrip(t *testing.T) {
+	w, path := create(t)
+	writeDetections(t, w, 0, time.Second, time.Second*6, time.Second*12)
+	if err := w.WriteFlag(start.Add(time.Second*6), Flag{Tick: 2, Type: "Reach", SubType: "A", Violations: 1.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if !f.Finalized() {
+		t.Error("expected recording to be finalized")
+	}
+	if hdr := f.Header(); hdr.SessionID != w.Header().SessionID || !hdr.StartTime.Equal(start) || hdr.RemoteAddr != "127.0.0.1:19132" {
+		t.Errorf("unexpected header %+v", hdr)
+	}
+	if meta := f.Metadata(); meta.Tenant != "network" || meta.ShieldID != 355 || meta.DisplayName != "Steve" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+	if n := len(f.Index()); n != 3 {
+		t.Errorf("expected 3 chunks, got %d", n)
+	}
+	if d := f.Duration(); d != time.Second*12 {
+		t.Errorf("expected duration of 12s, got %v", d)
+	}
+	if flags := f.Flags(); len(flags) != 1 || flags[0].Offset != time.Second*6 || flags[0].Violations != 1.5 {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+	if ticks := readTicks(t, f); len(ticks) != 4 || ticks[0] != 0 || ticks[3] != 3 {
+		t.Errorf("unexpected packets %v", ticks)
+	}
+	// The flag is written after the chunk holding the packet at 6s, so it extends the ticks of the last chunk.
+	for i, expected := range [][2]uint64{{0, 1}, {2, 2}, {2, 3}} {
+		if entry := f.Index()[i]; !entry.Ticked || entry.MinTick != expected[0] || entry.MaxTick != expected[1] {
+			t.Errorf("expected ticks %v in chunk %d, got %+v", expected, i, entry.ChunkInfo)
+		}
+	}
+}
+
+func TestTicks(t *testing.T) {
+	w, path := create(t)
+	if err := w.WritePacket(start, &cloudpacket.PlayerInfo{ShieldID: 355}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(start.Add(time.Second), &cloudpacket.GamePackets{Packets: []cloudpacket.GamePacket{
+		{Tick: 12}, {Tick: 10}, {Tick: 15},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFlag(start.Add(time.Second), Flag{Tick: 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	index := f.Index()
+	if len(index) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(index))
+	}
+	if index[0].Ticked {
+		t.Errorf("expected chunk without game packets or flags not to hold ticks, got %+v", index[0].ChunkInfo)
+	}
+	if !index[1].Ticked || index[1].MinTick != 9 || index[1].MaxTick != 15 {
+		t.Errorf("expected ticks 9-15 in chunk, got %+v", index[1].ChunkInfo)
+	}
+}
+
+func TestTruncatedRecording(t *testing.T) {
+	w, path := create(t)
+	defer w.Close()
+
+	writeDetections(t, w, 0, time.Second)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Packets written after the last flush are lost, as the chunk holding them was never written.
+	writeDetections(t, w, time.Second*2)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A chunk that was only partially written before a crash must be ignored.
+	data = append(data, blockTypeChunk, 0xff, 0x00, 0x00, 0x00, 0x01, 0x02)
+
+	f, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Finalized() {
+		t.Error("expected recording without trailer not to be finalized")
+	}
+	if meta := f.Metadata(); meta.ShieldID != 355 {
+		t.Errorf("expected metadata to be recovered, got %+v", meta)
+	}
+	if n := len(f.Index()); n != 1 {
+		t.Fatalf("expected 1 chunk in rebuilt index, got %d", n)
+	}
+	if ticks := readTicks(t, f); len(ticks) != 2 {
+		t.Errorf("expected 2 packets, got %v", ticks)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	w, path := create(t)
+	writeDetections(t, w, 0, time.Second)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := f.Index()[0]
+	data[entry.Offset+blockHeaderSize] ^= 0xff
+
+	f, err = NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadChunk(entry); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+// chunk returns a recording holding a single unfinalized chunk with the info passed, followed by the data passed
+// compressed as its entries.
+func chunk(t *testing.T, info ChunkInfo, data []byte) *File {
+	t.Helper()
+	w, path := create(t)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	recording, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := bytes.NewBuffer(nil)
+	info.Marshal(protocol.NewWriter(payload, 0))
+	zw := zlib.NewWriter(payload)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	buf := bytes.NewBuffer(recording)
+	if err := writeBlock(buf, blockTypeChunk, payload.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Index()) != 1 {
+		t.Fatalf("expected a single chunk, got %+v", f.Index())
+	}
+	return f
+}
+
+func TestCorruptChunk(t *testing.T) {
+	tests := map[string]struct {
+		info ChunkInfo
+		data []byte
+		err  string
+	}{
+		"packet count exceeds data":       {info: ChunkInfo{Packets: 1 << 31}, data: []byte{0, 0}, err: "cannot hold"},
+		"payload length exceeds data":     {info: ChunkInfo{Packets: 1}, data: []byte{0, 0xff, 0xff, 0xff, 0xff, 0x07}, err: "invalid payload length"},
+		"decompressed size exceeds limit": {info: ChunkInfo{Packets: 1}, data: make([]byte, maxBlockSize+1), err: "exceeds"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := chunk(t, test.info, test.data)
+			if _, err := f.ReadChunk(f.Index()[0]); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+
+	// A valid chunk built the same way must be readable.
+	f := chunk(t, ChunkInfo{Packets: 1}, []byte{2, 3, 1, 2, 3})
+	entries, err := f.ReadChunk(f.Index()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Offset != 1 || !bytes.Equal(entries[0].Payload, []byte{1, 2, 3}) {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	w, path := create(t)
+	writeDetections(t, w, 0, time.Second*6, time.Second*7, time.Second*12)
+	if err := w.WriteFlag(start.Add(time.Second*12), Flag{Tick: 3, Type: "Reach"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := bytes.NewBuffer(nil)
+	if err := Slice(buf, f, time.Second*5, time.Second*8); err != nil {
+		t.Fatal(err)
+	}
+	slice, err := NewFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slice.Finalized() {
+		t.Error("expected slice to be finalized")
+	}
+	if slice.Header().SessionID != f.Header().SessionID || slice.Metadata() != f.Metadata() {
+		t.Error("expected slice to preserve header and metadata")
+	}
+	if n := len(slice.Index()); n != 1 {
+		t.Fatalf("expected 1 chunk in slice, got %d", n)
+	}
+	if entry := slice.Index()[0]; entry.Start != time.Second*6 || entry.End != time.Second*7 {
+		t.Errorf("unexpected chunk range %v-%v", entry.Start, entry.End)
+	}
+	if len(slice.Flags()) != 0 {
+		t.Errorf("expected flags outside of the slice to be dropped, got %+v", slice.Flags())
+	}
+	if ticks := readTicks(t, slice); len(ticks) != 2 || ticks[0] != 1 || ticks[1] != 2 {
+		t.Errorf("unexpected packets %v", ticks)
+	}
+}
@@ -0,0 +1,75 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// Slice writes a finalized recording to w that only holds the chunks of the recording passed overlapping the
+// time range from-to, relative to the start of the recording. Chunks are copied without being decompressed, so
+// the recording written may hold packets slightly outside the time range. The header and metadata of the
+// recording are preserved, so offsets in the slice match those in the original recording.
+func Slice(w io.Writer, f *File, from, to time.Duration) error {
+	bw := bufio.NewWriter(w)
+	buf := bytes.NewBuffer(nil)
+
+	var preamble [preambleSize]byte
+	copy(preamble[:4], magic[:])
+	binary.LittleEndian.PutUint16(preamble[4:6], Version)
+	preamble[6] = CompressionZlib
+
+	hdr := f.hdr
+	hdr.Marshal(protocol.NewWriter(buf, 0))
+	_, _ = bw.Write(preamble[:])
+	_, _ = bw.Write(buf.Bytes())
+	offset := int64(preambleSize + buf.Len())
+
+	var index []IndexEntry
+	for _, entry := range f.index {
+		if entry.End < from || entry.Start > to {
+			continue
+		}
+		blockType, payload, err := readBlock(io.NewSectionReader(f.r, entry.Offset, math.MaxInt64-entry.Offset))
+		if err != nil {
+			return fmt.Errorf("failed to read chunk: %v", err)
+		}
+		if blockType != blockTypeChunk {
+			return fmt.Errorf("expected chunk at offset %d, got block type %d", entry.Offset, blockType)
+		}
+		if err := writeBlock(bw, blockTypeChunk, payload); err != nil {
+			return fmt.Errorf("failed to write chunk: %v", err)
+		}
+
+		entry.Offset = offset
+		index = append(index, entry)
+		offset += int64(blockHeaderSize + len(payload))
+	}
+
+	meta, err := json.Marshal(f.meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+	buf.Reset()
+	protoWriter := protocol.NewWriter(buf, 0)
+	protocol.Slice(protoWriter, &index)
+	protoWriter.ByteSlice(&meta)
+	if err := writeBlock(bw, blockTypeIndex, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+
+	var trailer [trailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[:8], uint64(offset))
+	copy(trailer[8:], indexMagic[:])
+	if _, err := bw.Write(trailer[:]); err != nil {
+		return fmt.Errorf("failed to write trailer: %v", err)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,346 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// MaxChunkSize is the maximum size of the uncompressed entries of a chunk. Once exceeded, the chunk is
+	// written to disk and a new chunk is started.
+	MaxChunkSize = 256 * 1024
+	// MaxChunkDuration is the maximum duration of time covered by a single chunk. It bounds the amount of
+	// packets that have to be decoded when seeking, as well as the amount of packets lost in a crash.
+	MaxChunkDuration = time.Second * 5
+)
+
+// Writer writes packets received from a session to a recording on disk.
+type Writer struct {
+	f *os.File
+	w *bufio.Writer
+	// offset is the amount of bytes written to the recording so far.
+	offset int64
+
+	hdr  Header
+	meta Metadata
+
+	// chunk contains the uncompressed entries of the chunk currently being written.
+	chunk     *bytes.Buffer
+	chunkInfo ChunkInfo
+	// pkBuffer is the buffer that packets are encoded into before they are written as an entry.
+	pkBuffer *bytes.Buffer
+	// blockBuffer is the buffer that the payload of a block is encoded into before it is written.
+	blockBuffer *bytes.Buffer
+	compressor  *zlib.Writer
+
+	index []IndexEntry
+	// packets is the total amount of packets written to the recording, and flags the total amount of flags.
+	packets uint64
+	flags   int
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Create creates a new recording at the path passed and writes the header to it. If a file already
+// exists at the path, an error is returned.
+func Create(path string, hdr Header) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %v", err)
+	}
+
+	w := &Writer{
+		f:           f,
+		w:           bufio.NewWriter(f),
+		hdr:         hdr,
+		chunk:       bytes.NewBuffer(make([]byte, 0, MaxChunkSize)),
+		pkBuffer:    bytes.NewBuffer(make([]byte, 0, 4096)),
+		blockBuffer: bytes.NewBuffer(make([]byte, 0, MaxChunkSize)),
+	}
+	w.compressor, _ = zlib.NewWriterLevel(w.blockBuffer, zlib.BestSpeed)
+
+	var preamble [preambleSize]byte
+	copy(preamble[:4], magic[:])
+	binary.LittleEndian.PutUint16(preamble[4:6], Version)
+	preamble[6] = CompressionZlib
+
+	hdr.Marshal(protocol.NewWriter(w.blockBuffer, 0))
+	_, _ = w.w.Write(preamble[:])
+	_, _ = w.w.Write(w.blockBuffer.Bytes())
+	w.offset = int64(preambleSize + w.blockBuffer.Len())
+
+	if err := w.w.Flush(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to write recording header: %v", err)
+	}
+	return w, nil
+}
+
+// Header returns the header of the recording.
+func (w *Writer) Header() Header {
+	return w.hdr
+}
+
+// Metadata returns the latest metadata of the recording.
+func (w *Writer) Metadata() Metadata {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.meta
+}
+
+// Packets returns the total amount of packets written to the recording.
+func (w *Writer) Packets() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.packets
+}
+
+// Flags returns the total amount of flags written to the recording.
+func (w *Writer) Flags() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flags
+}
+
+// Size returns the amount of bytes written to the recording on disk. Packets buffered in the current chunk
+// are not included.
+func (w *Writer) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.offset
+}
+
+// SetMetadata writes the metadata passed to the recording, replacing any metadata previously written. The
+// shield ID of the metadata is used to encode packets written afterwards.
+func (w *Writer) SetMetadata(meta Metadata) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("recording closed")
+	}
+
+	// Packets buffered in the current chunk were encoded with the previous shield ID, so they are written
+	// before the new metadata.
+	if err := w.writeChunk(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+	if err := w.writeBlock(blockTypeMetadata, payload); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	w.offset += int64(blockHeaderSize + len(payload))
+	w.meta = meta
+	return nil
+}
+
+// WritePacket writes a packet received at the time passed to the recording. The packet is buffered in the
+// current chunk, which is written to disk once it exceeds MaxChunkSize or MaxChunkDuration.
+func (w *Writer) WritePacket(t time.Time, pk packet.Packet) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("recording closed")
+	}
+
+	offset := t.Sub(w.hdr.StartTime)
+	if !w.chunkEmpty() && offset-w.chunkInfo.Start >= MaxChunkDuration {
+		if err := w.writeChunk(); err != nil {
+			return err
+		}
+	}
+
+	w.pkBuffer.Reset()
+	pkWriter := protocol.NewWriter(w.pkBuffer, w.meta.ShieldID)
+	packetID := pk.ID()
+	pkWriter.Uint32(&packetID)
+	pk.Marshal(pkWriter)
+	if w.pkBuffer.Len() > maxPacketSize {
+		return fmt.Errorf("packet of %d bytes exceeds maximum of %d", w.pkBuffer.Len(), maxPacketSize)
+	}
+
+	var (
+		entryOffset = int64(offset)
+		payload     = w.pkBuffer.Bytes()
+		chunkWriter = protocol.NewWriter(w.chunk, 0)
+	)
+	chunkWriter.Varint64(&entryOffset)
+	chunkWriter.ByteSlice(&payload)
+
+	w.extendChunk(offset)
+	if low, high, ok := Ticks(pk); ok {
+		w.extendTicks(low, high)
+	}
+	w.chunkInfo.Packets++
+	w.packets++
+
+	if w.chunk.Len() >= MaxChunkSize {
+		return w.writeChunk()
+	}
+	return nil
+}
+
+// WriteFlag adds a flag that occurred at the time passed to the timeline of the recording. The flag is stored
+// in the info of the current chunk.
+func (w *Writer) WriteFlag(t time.Time, flag Flag) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("recording closed")
+	}
+
+	flag.Offset = t.Sub(w.hdr.StartTime)
+	w.extendChunk(flag.Offset)
+	w.extendTicks(flag.Tick, flag.Tick)
+	w.chunkInfo.Flags = append(w.chunkInfo.Flags, flag)
+	w.flags++
+	return nil
+}
+
+// Flush writes the chunk currently being recorded to disk, even if it has not yet reached MaxChunkSize or
+// MaxChunkDuration.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("recording closed")
+	}
+	return w.writeChunk()
+}
+
+// Close finalizes the recording by writing the pending chunk, the index and the trailer, and syncing the
+// file to disk. Calling Close more than once has no effect.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := w.writeChunk(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	if err := w.writeIndex(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		_ = w.f.Close()
+		return fmt.Errorf("failed to sync recording: %v", err)
+	}
+	return w.f.Close()
+}
+
+// writeChunk compresses the entries of the current chunk and writes it to disk as a chunk block. If the
+// current chunk is empty, nothing is written.
+func (w *Writer) writeChunk() error {
+	if w.chunkEmpty() {
+		return nil
+	}
+
+	w.blockBuffer.Reset()
+	w.chunkInfo.Marshal(protocol.NewWriter(w.blockBuffer, 0))
+	w.compressor.Reset(w.blockBuffer)
+	if _, err := w.compressor.Write(w.chunk.Bytes()); err != nil {
+		return fmt.Errorf("failed to compress chunk: %v", err)
+	}
+	if err := w.compressor.Close(); err != nil {
+		return fmt.Errorf("failed to compress chunk: %v", err)
+	}
+
+	if err := w.writeBlock(blockTypeChunk, w.blockBuffer.Bytes()); err != nil {
+		return fmt.Errorf("failed to write chunk: %v", err)
+	}
+	w.index = append(w.index, IndexEntry{ChunkInfo: w.chunkInfo, Offset: w.offset})
+	w.offset += int64(blockHeaderSize + w.blockBuffer.Len())
+
+	w.chunk.Reset()
+	w.chunkInfo = ChunkInfo{}
+	return nil
+}
+
+// chunkEmpty returns true if no packets or flags have been written to the current chunk.
+func (w *Writer) chunkEmpty() bool {
+	return w.chunkInfo.Packets == 0 && len(w.chunkInfo.Flags) == 0
+}
+
+// extendChunk extends the time range of the current chunk to include the offset passed.
+func (w *Writer) extendChunk(offset time.Duration) {
+	if w.chunkEmpty() {
+		w.chunkInfo.Start = offset
+	}
+	w.chunkInfo.End = max(w.chunkInfo.End, offset)
+}
+
+// extendTicks extends the range of ticks of the current chunk to include the range low-high.
+func (w *Writer) extendTicks(low, high uint64) {
+	if !w.chunkInfo.Ticked {
+		w.chunkInfo.Ticked, w.chunkInfo.MinTick, w.chunkInfo.MaxTick = true, low, high
+		return
+	}
+	w.chunkInfo.MinTick, w.chunkInfo.MaxTick = min(w.chunkInfo.MinTick, low), max(w.chunkInfo.MaxTick, high)
+}
+
+// writeIndex writes the index block and the trailer pointing to it.
+func (w *Writer) writeIndex() error {
+	meta, err := json.Marshal(w.meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+
+	w.blockBuffer.Reset()
+	protoWriter := protocol.NewWriter(w.blockBuffer, 0)
+	protocol.Slice(protoWriter, &w.index)
+	protoWriter.ByteSlice(&meta)
+
+	if err := w.writeBlock(blockTypeIndex, w.blockBuffer.Bytes()); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+
+	var trailer [trailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[:8], uint64(w.offset))
+	copy(trailer[8:], indexMagic[:])
+	w.offset += int64(blockHeaderSize + w.blockBuffer.Len())
+
+	if _, err := w.w.Write(trailer[:]); err != nil {
+		return fmt.Errorf("failed to write trailer: %v", err)
+	}
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write trailer: %v", err)
+	}
+	w.offset += trailerSize
+	return nil
+}
+
+// writeBlock writes a block to the recording and flushes it to the file, so that it survives the process
+// crashing.
+func (w *Writer) writeBlock(blockType byte, payload []byte) error {
+	if err := writeBlock(w.w, blockType, payload); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
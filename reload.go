@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/config"
+)
+
+// reloadMu ensures only one reload runs at a time.
+var reloadMu sync.Mutex
+
+// watchReload reloads the configuration whenever a signal is received on the channel passed, or whenever one of
+// the files it depends on changes, if watching is enabled.
+func watchReload(signals <-chan os.Signal) {
+	// The files watched are those of the configuration last applied, as reloading may change their paths.
+	watched := *cfg.Load()
+	var tick <-chan time.Time
+	if watched.Reload.WatchInterval > 0 {
+		t := time.NewTicker(watched.Reload.WatchInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	modTimes := watchedModTimes(watched)
+	for {
+		select {
+		case <-signals:
+			logger.Info().Msg("reloading configuration after SIGHUP")
+		case <-tick:
+			current := watchedModTimes(watched)
+			if reflect.DeepEqual(current, modTimes) {
+				continue
+			}
+			modTimes = current
+			logger.Info().Msg("reloading configuration after file change")
+		}
+		c, err := reload()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to reload configuration")
+			continue
+		}
+		watched = c
+		modTimes = watchedModTimes(watched)
+	}
+}
+
+// watchedModTimes returns the modification times of the configuration file and the files referenced by it
+// that are applied on reload.
+func watchedModTimes(c config.Config) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range []string{c.Path, c.TLS.CertFile, c.TLS.KeyFile, c.Storage.TenantPolicies} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// reload parses the configuration again and applies it without interrupting clients already connected. The TLS
+// certificate, token verification keys, revocations, tenant policies and client limits are replaced, and apply
+// to new connections and sessions. Options that can only be applied on startup keep their current value, and a
+// warning is logged if they changed. Nothing is applied if any part of the new configuration is invalid, or if it
+// removes the token verification keys. The configuration applied is returned.
+func reload() (config.Config, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c, err := config.Parse(os.Args[0], os.Args[1:])
+	if err != nil {
+		return c, err
+	}
+	running := *cfg.Load()
+	// The keys cannot be unloaded once configured, so removing them would silently keep validating tokens with the
+	// old keys.
+	if tokensConfigured(running.Auth.JWT) && !tokensConfigured(c.Auth.JWT) {
+		return c, fmt.Errorf("auth.jwt cannot be removed while the server is running, restart the server to remove it")
+	}
+	for _, option := range restartRequired(running, c) {
+		logger.Warn().Str("option", option).Msg("changed option requires a restart to take effect")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+	if err != nil {
+		return c, fmt.Errorf("unable to load TLS certificate: %v", err)
+	}
+	policies, err := loadPolicies(c)
+	if err != nil {
+		return c, err
+	}
+	var jwtCfg jwt.Config
+	if tokensConfigured(c.Auth.JWT) {
+		if jwtCfg, err = jwtConfig(c.Auth.JWT); err != nil {
+			return c, fmt.Errorf("unable to configure token validation: %v", err)
+		}
+	}
+
+	certificate.Store(&cert)
+	tenants.SetPolicies(policies)
+	clientCfg.Store(clientConfig(c))
+	if tokensConfigured(c.Auth.JWT) {
+		jwt.Configure(jwtCfg)
+		if keys, ok := jwtKeys.(*jwt.JWKSProvider); ok {
+			keys.Close()
+		}
+		jwtKeys = jwtCfg.Keys
+	}
+	if err := revocations.Reload(); err != nil {
+		logger.Error().Err(err).Msg("failed to reload revocations")
+	}
+
+	applied := keepRestartRequired(running, c)
+	cfg.Store(&applied)
+	logger.Info().Msg("configuration reloaded")
+	return applied, nil
+}
+
+// restartRequired returns the names of the options that differ between the running and new configuration, but
+// can only be applied on startup.
+func restartRequired(running, c config.Config) []string {
+	var options []string
+	check := func(option string, changed bool) {
+		if changed {
+			options = append(options, option)
+		}
+	}
+	check("listener", running.Listener != c.Listener)
+	check("http", running.HTTP != c.HTTP)
+	check("tls.client_ca_file", running.TLS.ClientCAFile != c.TLS.ClientCAFile)
+	check("auth.mode", running.Auth.Mode != c.Auth.Mode)
+	check("auth.revocations_path", running.Auth.RevocationsPath != c.Auth.RevocationsPath)
+	check("storage.recording_dir", running.Storage.RecordingDir != c.Storage.RecordingDir)
+	check("storage.catalogue_path", running.Storage.CataloguePath != c.Storage.CataloguePath)
+	check("storage.janitor_interval", running.Storage.JanitorInterval != c.Storage.JanitorInterval)
+	check("logging", running.Logging != c.Logging)
+	check("sentry", running.Sentry != c.Sentry)
+	check("reload", running.Reload != c.Reload)
+	return options
+}
+
+// keepRestartRequired returns the new configuration passed, with the options listed by restartRequired set to
+// their value in the running configuration.
+func keepRestartRequired(running, c config.Config) config.Config {
+	c.Listener = running.Listener
+	c.HTTP = running.HTTP
+	c.TLS.ClientCAFile = running.TLS.ClientCAFile
+	c.Auth.Mode = running.Auth.Mode
+	c.Auth.RevocationsPath = running.Auth.RevocationsPath
+	c.Storage.RecordingDir = running.Storage.RecordingDir
+	c.Storage.CataloguePath = running.Storage.CataloguePath
+	c.Storage.JanitorInterval = running.Storage.JanitorInterval
+	c.Logging = running.Logging
+	c.Sentry = running.Sentry
+	c.Reload = running.Reload
+	return c
+}
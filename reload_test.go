@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/config"
+)
+
+func TestKeepRestartRequired(t *testing.T) {
+	running := config.Default()
+	c := config.Default()
+	c.Listener.Address = ":19134"
+	c.HTTP.Address = ""
+	c.TLS.CertFile = "new-cert.pem"
+	c.TLS.ClientCAFile = "ca.pem"
+	c.Auth.Mode = "certificate"
+	c.Auth.RevocationsPath = "new-revocations.json"
+	c.Auth.JWT.Secret = "new-secret"
+	c.Storage.RecordingDir = "new-recordings"
+	c.Storage.CataloguePath = "catalogue.jsonl"
+	c.Storage.TenantPolicies = "policies.json"
+	c.Storage.JanitorInterval = time.Minute
+	c.Limits.FlushInterval = time.Second
+	c.Logging.Level = "debug"
+	c.Sentry.DSN = "https://sentry.example"
+	c.Reload.WatchInterval = 0
+
+	if n := len(restartRequired(running, c)); n != 11 {
+		t.Errorf("expected 11 options to require a restart, got %d", n)
+	}
+	applied := keepRestartRequired(running, c)
+	if options := restartRequired(running, applied); len(options) != 0 {
+		t.Errorf("expected options requiring a restart to keep their running value, got %v", options)
+	}
+	if applied.TLS.CertFile != c.TLS.CertFile || applied.Auth.JWT.Secret != c.Auth.JWT.Secret ||
+		applied.Storage.TenantPolicies != c.Storage.TenantPolicies || applied.Limits != c.Limits {
+		t.Error("expected options applied on reload to take their new value")
+	}
+}
+
+func TestReloadRemovingJWT(t *testing.T) {
+	start(t)
+	dir := t.TempDir()
+
+	// The certificate loaded by start is written to disk, so that the reloaded configuration is valid apart from
+	// removing auth.jwt. Proxies authenticate by their certificate, so auth.jwt is optional.
+	cert := certificate.Load()
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	data := fmt.Sprintf("tls:\n  cert_file: %s\n  key_file: %s\n  client_ca_file: %s\nauth:\n  mode: certificate\n",
+		certFile, keyFile, certFile)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := os.Args
+	os.Args = []string{"ocloud", "-config", path}
+	defer func() {
+		os.Args = args
+	}()
+	running := *cfg.Load()
+	if _, err := reload(); err == nil || !strings.Contains(err.Error(), "auth.jwt cannot be removed") {
+		t.Fatalf("expected reload removing auth.jwt to be rejected, got %v", err)
+	}
+	if cfg.Load().Auth.JWT.Secret != running.Auth.JWT.Secret {
+		t.Error("expected configuration not to be applied")
+	}
+	if jwtCfg, ok := jwt.Current(); !ok || jwtCfg.Keys == nil {
+		t.Error("expected token verification keys to stay loaded")
+	}
+}
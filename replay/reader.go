@@ -0,0 +1,198 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/recording"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Packet is a packet read from a recording, along with the time it was received at.
+type Packet struct {
+	// Time is the time at which the packet was received by the server.
+	Time time.Time
+	// Offset is the time at which the packet was received, relative to the start of the recording.
+	Offset time.Duration
+	// Packet is the decoded packet.
+	Packet packet.Packet
+}
+
+// Reader reads packets from a recording in the order they were received. Packets are decoded using the same
+// packet pool that the server uses to decode packets sent by a proxy.
+type Reader struct {
+	f *recording.File
+
+	// chunk is the index of the chunk currently being read, and entries are the entries it contains.
+	chunk   int
+	entries []recording.Entry
+	pos     int
+
+	filter map[uint32]struct{}
+}
+
+// Open opens the recording at the path passed and returns a Reader positioned at the start of it.
+func Open(path string) (*Reader, error) {
+	f, err := recording.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(f), nil
+}
+
+// NewReader returns a Reader that reads packets from the recording passed, positioned at the start of it.
+func NewReader(f *recording.File) *Reader {
+	return &Reader{f: f, chunk: -1}
+}
+
+// File returns the recording the Reader reads from.
+func (r *Reader) File() *recording.File {
+	return r.f
+}
+
+// Header returns the header of the recording the Reader reads from.
+func (r *Reader) Header() recording.Header {
+	return r.f.Header()
+}
+
+// Metadata returns the metadata of the recording the Reader reads from.
+func (r *Reader) Metadata() recording.Metadata {
+	return r.f.Metadata()
+}
+
+// Filter limits the packets returned by Next to those with one of the IDs passed. Packets with other IDs are
+// skipped without being decoded. Calling Filter without any IDs removes the filter.
+func (r *Reader) Filter(ids ...uint32) {
+	if len(ids) == 0 {
+		r.filter = nil
+		return
+	}
+	r.filter = make(map[uint32]struct{}, len(ids))
+	for _, id := range ids {
+		r.filter[id] = struct{}{}
+	}
+}
+
+// Seek positions the Reader at the first packet received at or after the offset passed, relative to the start
+// of the recording. Only the chunk containing the offset is decoded.
+func (r *Reader) Seek(offset time.Duration) error {
+	index := r.f.Index()
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].End >= offset
+	})
+	if err := r.loadChunk(i); err != nil {
+		return err
+	}
+	r.pos = sort.Search(len(r.entries), func(i int) bool {
+		return r.entries[i].Offset >= offset
+	})
+	return nil
+}
+
+// SeekTime positions the Reader at the first packet received at or after the time passed.
+func (r *Reader) SeekTime(t time.Time) error {
+	return r.Seek(t.Sub(r.f.Header().StartTime))
+}
+
+// SeekTick positions the Reader at the first packet carrying a tick of the player at or after the tick passed. Only
+// GamePackets and Detection packets carry ticks. The chunk holding the tick is found using the index, so only that
+// chunk is decoded. If no packet carries such a tick, the Reader is positioned at the end of the recording.
+func (r *Reader) SeekTick(tick uint64) error {
+	index := r.f.Index()
+	for i, entry := range index {
+		if !entry.Ticked || entry.MaxTick < tick {
+			continue
+		}
+		if err := r.loadChunk(i); err != nil {
+			return err
+		}
+		for pos, e := range r.entries {
+			pk, err := r.decode(e.Payload)
+			if err != nil {
+				return fmt.Errorf("failed to decode packet at %v: %v", e.Offset, err)
+			}
+			if _, high, ok := recording.Ticks(pk); ok && high >= tick {
+				r.pos = pos
+				return nil
+			}
+		}
+	}
+	return r.loadChunk(len(index))
+}
+
+// Next reads the next packet from the recording. If a filter is set, packets not matching the filter are
+// skipped. io.EOF is returned once all packets have been read.
+func (r *Reader) Next() (Packet, error) {
+	for {
+		for r.pos >= len(r.entries) {
+			if r.chunk+1 >= len(r.f.Index()) {
+				return Packet{}, io.EOF
+			}
+			if err := r.loadChunk(r.chunk + 1); err != nil {
+				return Packet{}, err
+			}
+		}
+
+		entry := r.entries[r.pos]
+		r.pos++
+		if r.filter != nil && len(entry.Payload) >= 4 {
+			if _, ok := r.filter[binary.LittleEndian.Uint32(entry.Payload)]; !ok {
+				continue
+			}
+		}
+
+		pk, err := r.decode(entry.Payload)
+		if err != nil {
+			return Packet{}, fmt.Errorf("failed to decode packet at %v: %v", entry.Offset, err)
+		}
+		return Packet{
+			Time:   r.f.Header().StartTime.Add(entry.Offset),
+			Offset: entry.Offset,
+			Packet: pk,
+		}, nil
+	}
+}
+
+// DecodeGamePacket decodes a game packet read from the recording into a Minecraft packet, using the shield ID
+// of the recorded session.
+func (r *Reader) DecodeGamePacket(pk cloudpacket.GamePacket) (packet.Packet, error) {
+	return pk.Decode(r.f.Metadata().ShieldID)
+}
+
+// Close closes the recording the Reader reads from.
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// loadChunk loads the entries of the chunk at the index passed. If the index is past the last chunk, the
+// Reader is positioned at the end of the recording.
+func (r *Reader) loadChunk(i int) error {
+	index := r.f.Index()
+	if i >= len(index) {
+		r.chunk, r.entries, r.pos = len(index)-1, nil, 0
+		return nil
+	}
+
+	entries, err := r.f.ReadChunk(index[i])
+	if err != nil {
+		return err
+	}
+	r.chunk, r.entries, r.pos = i, entries, 0
+	return nil
+}
+
+// decode decodes the packet payload passed through cloudpacket.Decode.
+func (r *Reader) decode(payload []byte) (pk packet.Packet, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%v", v)
+		}
+	}()
+	return cloudpacket.Decode(protocol.NewReader(bytes.NewBuffer(payload), r.f.Metadata().ShieldID, false))
+}
@@ -0,0 +1,140 @@
+package replay_test
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/recording"
+	"github.com/oomph-ac/ocloud/replay"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// record writes a recording holding a Detection packet at every second from 0 to 19, followed by a
+// PlayerInfo packet, and returns its path.
+func record(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session.ocr")
+	w, err := recording.Create(path, recording.Header{SessionID: uuid.New(), StartTime: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if err := w.WritePacket(start.Add(time.Duration(i)*time.Second), &cloudpacket.Detection{Tick: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WritePacket(start.Add(time.Second*20), &cloudpacket.PlayerInfo{ShieldID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReaderNext(t *testing.T) {
+	r, err := replay.Open(record(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := range 21 {
+		pk, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pk.Offset != time.Duration(i)*time.Second || !pk.Time.Equal(start.Add(pk.Offset)) {
+			t.Fatalf("unexpected offset %v of packet %d", pk.Offset, i)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	r, err := replay.Open(record(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, offset := range []time.Duration{time.Second * 12, time.Second*7 + time.Millisecond, 0, time.Second * 19} {
+		if err := r.Seek(offset); err != nil {
+			t.Fatal(err)
+		}
+		pk, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := offset.Truncate(time.Second)
+		if offset != expected {
+			expected += time.Second
+		}
+		if pk.Offset != expected || pk.Packet.(*cloudpacket.Detection).Tick != uint64(expected/time.Second) {
+			t.Errorf("seek to %v: expected packet at %v, got %v", offset, expected, pk.Offset)
+		}
+	}
+
+	if err := r.Seek(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF after seeking past the end, got %v", err)
+	}
+}
+
+func TestReaderSeekTick(t *testing.T) {
+	r, err := replay.Open(record(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, tick := range []uint64{12, 7, 0, 19} {
+		if err := r.SeekTick(tick); err != nil {
+			t.Fatal(err)
+		}
+		pk, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detection := pk.Packet.(*cloudpacket.Detection); detection.Tick != tick {
+			t.Errorf("seek to tick %v: got packet with tick %v", tick, detection.Tick)
+		}
+	}
+
+	if err := r.SeekTick(20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF after seeking past the last tick, got %v", err)
+	}
+}
+
+func TestReaderFilter(t *testing.T) {
+	r, err := replay.Open(record(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Filter(cloudpacket.IDPlayerInfo)
+	pk, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pk.Packet.(*cloudpacket.PlayerInfo); !ok {
+		t.Errorf("expected PlayerInfo, got %T", pk.Packet)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
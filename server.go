@@ -1,72 +1,278 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
+	"github.com/oomph-ac/ocloud/catalogue"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/certauth"
+	"github.com/oomph-ac/ocloud/client/handler"
+	"github.com/oomph-ac/ocloud/client/jwt"
+	"github.com/oomph-ac/ocloud/client/registry"
+	"github.com/oomph-ac/ocloud/config"
+	"github.com/oomph-ac/ocloud/metrics"
+	cloudpacket "github.com/oomph-ac/ocloud/packet"
+	"github.com/oomph-ac/ocloud/tenant"
 	"github.com/quic-go/quic-go"
 	"github.com/rs/zerolog"
 )
 
 var (
 	logger zerolog.Logger
+	// cfg is the configuration currently applied. It is replaced when the configuration is reloaded, with the
+	// options that can only be applied on startup keeping the value the server was started with.
+	cfg atomic.Pointer[config.Config]
+	// clientCfg holds the options every new client is created with.
+	clientCfg atomic.Pointer[client.Config]
+	// certificate is the TLS certificate presented to proxies.
+	certificate atomic.Pointer[tls.Certificate]
+	// jwtKeys is the key provider currently used to verify tokens. It is closed once it is replaced.
+	jwtKeys jwt.KeyProvider
+	// sessions is the catalogue of all recorded sessions.
+	sessions catalogue.Catalogue
+	// revocations is the store of all revoked tokens.
+	revocations *jwt.RevocationStore
+	// authMode is the mode determining the credentials proxies must present to be authenticated.
+	authMode handler.AuthMode
+	// clients is the registry of all clients currently connected.
+	clients = registry.New()
+	// tenants is the manager enforcing the quotas and retention policies of all tenants.
+	tenants *tenant.Manager
+	// janitor deletes recordings that outlived the retention policy of their tenant.
+	janitor *tenant.Janitor
 )
 
-func init() {
-	f, err := os.OpenFile("server.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+// setup initializes the logger, storage, authentication and Sentry according to the configuration passed.
+func setup(c config.Config) (err error) {
+	cfg.Store(&c)
+	logOutput := os.Stderr
+	if c.Logging.File != "" {
+		if logOutput, err = os.OpenFile(c.Logging.File, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666); err != nil {
+			return fmt.Errorf("unable to open log file: %v", err)
+		}
+	}
+	level, _ := zerolog.ParseLevel(c.Logging.Level)
+	logger = zerolog.New(logOutput).Level(level)
+
+	clientCfg.Store(clientConfig(c))
+
+	if err := os.MkdirAll(c.Storage.RecordingDir, 0755); err != nil {
+		return fmt.Errorf("unable to create recording directory: %v", err)
+	}
+	cataloguePath := c.Storage.CataloguePath
+	if cataloguePath == "" {
+		cataloguePath = filepath.Join(c.Storage.RecordingDir, "catalogue.jsonl")
+	}
+	if sessions, err = catalogue.OpenFile(cataloguePath); err != nil {
+		return fmt.Errorf("unable to open session catalogue: %v", err)
+	}
+
+	policies, err := loadPolicies(c)
 	if err != nil {
-		fmt.Printf("Unable to open log file: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	tenants = tenant.NewManager(policies)
+	if janitor, err = tenant.NewJanitor(sessions, tenants, clients, logger); err != nil {
+		return fmt.Errorf("unable to initialize retention janitor: %v", err)
+	}
+
+	if authMode, err = handler.ParseAuthMode(c.Auth.Mode); err != nil {
+		return err
+	}
+	// Tokens are validated whenever keys are configured, even if proxies authenticate with their certificate
+	// alone, as they are also used to authenticate requests to the admin and replay APIs.
+	if tokensConfigured(c.Auth.JWT) {
+		jwtCfg, err := jwtConfig(c.Auth.JWT)
+		if err != nil {
+			return fmt.Errorf("unable to configure token validation: %v", err)
+		}
+		jwt.Configure(jwtCfg)
+		jwtKeys = jwtCfg.Keys
+	}
+	if revocations, err = jwt.NewRevocationStore(c.Auth.RevocationsPath); err != nil {
+		return fmt.Errorf("unable to load token revocations: %v", err)
 	}
-	logger = zerolog.New(f)
 
-	if sentryDsn := os.Getenv("SENTRY_DSN"); sentryDsn != "" {
+	if c.Sentry.DSN != "" {
 		if err := sentry.Init(sentry.ClientOptions{
-			Dsn: sentryDsn,
+			Dsn: c.Sentry.DSN,
 		}); err != nil {
-			fmt.Printf("Failed to initalize Sentry: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("failed to initalize Sentry: %v", err)
+		}
+	}
+	return nil
+}
+
+// clientConfig returns the options new clients are created with according to the configuration passed.
+func clientConfig(c config.Config) *client.Config {
+	return &client.Config{
+		FlushInterval:    c.Limits.FlushInterval,
+		CompressionLevel: c.Limits.CompressionLevel,
+		MaxBatchSize:     c.Limits.MaxBatchSize,
+		ReadBufferSize:   c.Limits.ReadBufferSize,
+		WriteBufferSize:  c.Limits.WriteBufferSize,
+	}
+}
+
+// loadPolicies loads the tenant policies set in the configuration passed. If no policies are set, no limits
+// apply to any tenant.
+func loadPolicies(c config.Config) (tenant.Policies, error) {
+	if c.Storage.TenantPolicies == "" {
+		return tenant.Policies{}, nil
+	}
+	policies, err := tenant.LoadPolicies(c.Storage.TenantPolicies)
+	if err != nil {
+		return policies, fmt.Errorf("unable to load tenant policies: %v", err)
+	}
+	return policies, nil
+}
+
+// tokensConfigured returns true if the configuration passed holds keys that tokens can be verified with.
+func tokensConfigured(c config.JWTConfig) bool {
+	return c.JWKS != "" || c.Secret != ""
+}
+
+// jwtConfig creates the rules that tokens are validated against from the configuration passed. Keys are loaded
+// from the JWKS if set, or otherwise from the HMAC secret.
+func jwtConfig(c config.JWTConfig) (jwt.Config, error) {
+	var keys jwt.KeyProvider = jwt.SecretKey(c.Secret)
+	if c.JWKS != "" {
+		provider, err := jwt.NewJWKSProvider(c.JWKS, c.JWKSRefresh, c.JWKSGrace, logger)
+		if err != nil {
+			return jwt.Config{}, err
 		}
+		keys = provider
+	}
+
+	jwtCfg := jwt.DefaultConfig(keys)
+	jwtCfg.Issuer = c.Issuer
+	jwtCfg.Audience = c.Audience
+	if len(c.Algorithms) > 0 {
+		jwtCfg.Algorithms = c.Algorithms
 	}
+	jwtCfg.Leeway = c.Leeway
+	jwtCfg.RequireExpiry = !c.AllowNoExpiry
+	return jwtCfg, nil
 }
 
+// generateTLSConfig creates the TLS configuration of the listener. The certificate is looked up for every
+// connection, so that it can be replaced while the server is running.
 func generateTLSConfig(pemFile, certFile string) (*tls.Config, error) {
 	cert, err := tls.LoadX509KeyPair(certFile, pemFile)
 	if err != nil {
 		return nil, err
 	}
+	certificate.Store(&cert)
 
-	return &tls.Config{
+	tlsCfg := &tls.Config{
 		InsecureSkipVerify: false,
-		Certificates:       []tls.Certificate{cert},
-		ServerName:         "*.oomph.ac",
-	}, nil
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certificate.Load(), nil
+		},
+	}
+	if caFile := cfg.Load().TLS.ClientCAFile; caFile != "" {
+		if tlsCfg.ClientCAs, err = certauth.LoadCAPool(caFile); err != nil {
+			return nil, err
+		}
+		// Client certificates are only required if they are used to authenticate proxies. Otherwise, proxies
+		// without a certificate are still accepted, but any certificate presented must be valid.
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if authMode.RequiresCertificate() {
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsCfg, nil
+}
+
+// watchSessions logs every session connecting and disconnecting, and observes the duration of every session once
+// it is closed.
+func watchSessions() {
+	clients.OnConnect(func(c *client.Client) {
+		logger.Debug().
+			Str("session_id", c.SessionID().String()).
+			Str("addr", c.Addr().String()).
+			Msg("session connected")
+	})
+	clients.OnDisconnect(func(c *client.Client) {
+		duration := time.Since(c.ConnectedAt())
+		metrics.SessionDuration.WithLabelValues(c.Tenant()).Observe(duration.Seconds())
+		logger.Debug().
+			Str("session_id", c.SessionID().String()).
+			Str("tenant", c.Tenant()).
+			Dur("duration", duration).
+			Msg("session disconnected")
+	})
+}
+
+// watchRevocations periodically reloads the revocation store, so that tokens revoked by adding them to the
+// revocations file are picked up and the sessions using them are closed.
+func watchRevocations() {
+	t := time.NewTicker(time.Second * 10)
+	defer t.Stop()
+
+	for range t.C {
+		if err := revocations.Reload(); err != nil {
+			logger.Error().Err(err).Msg("failed to reload revocations")
+		}
+	}
 }
 
 func main() {
-	if len(os.Args) < 4 {
-		fmt.Println("Usage: ./oCloud <listen_addr> <pem_file> <cert_file>")
+	c, err := config.Parse(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	}
+	if err != nil {
+		fmt.Printf("Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if err := setup(c); err != nil {
+		fmt.Printf("Failed to start: %v\n", err)
+		os.Exit(1)
+	}
 
-	listenAddr, pemFile, certFile := os.Args[1], os.Args[2], os.Args[3]
-	fmt.Printf("Listening on %s with PEM file %s and cert file %s\n", listenAddr, pemFile, certFile)
+	listenAddr := c.Listener.Address
+	fmt.Printf("Listening on %s with key file %s and cert file %s\n", listenAddr, c.TLS.KeyFile, c.TLS.CertFile)
 
 	var interruptSignal = make(chan os.Signal, 1)
-	signal.Notify(interruptSignal, os.Interrupt)
+	signal.Notify(interruptSignal, os.Interrupt, syscall.SIGTERM)
+	var reloadSignal = make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
 
-	tlsCfg, err := generateTLSConfig(pemFile, certFile)
+	tlsCfg, err := generateTLSConfig(c.TLS.KeyFile, c.TLS.CertFile)
 	if err != nil {
 		fmt.Printf("Failed to generate TLS config: %v\n", err)
 		return
 	}
 
-	l, err := quic.ListenAddr(listenAddr, tlsCfg, &quic.Config{
-		KeepAlivePeriod: time.Second,
+	// The transport is created separately from the listener, so that the listener can be closed to stop
+	// accepting connections while the connections already accepted are drained.
+	udpAddr, err := net.ResolveUDPAddr("udp", listenAddr)
+	if err != nil {
+		fmt.Printf("Failed to resolve %s: %v\n", listenAddr, err)
+		return
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		fmt.Printf("Failed to listen on %s: %v\n", listenAddr, err)
+		return
+	}
+	tr := &quic.Transport{Conn: udpConn}
+	l, err := tr.Listen(tlsCfg, &quic.Config{
+		KeepAlivePeriod: c.Listener.KeepAlivePeriod,
 		EnableDatagrams: false,
 	})
 	if err != nil {
@@ -74,6 +280,64 @@ func main() {
 		return
 	}
 
-	go listen(l)
+	metrics.RegisterSessions(clients)
+	watchSessions()
+	httpServer := startHTTP(c.HTTP.Address)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listening.Store(true)
+	go listen(ctx, l)
+	go watchRevocations()
+	go janitor.Run(c.Storage.JanitorInterval)
+	go watchReload(reloadSignal)
 	<-interruptSignal
+
+	fmt.Println("Shutting down...")
+	cancel()
+	shutdown(l, tr, httpServer)
+}
+
+// shutdown stops accepting new connections and streams, disconnects all clients once the batches they are
+// processing are handled, and waits for their handlers to be closed so that all recordings are finalized. If
+// this takes longer than the shutdown timeout, the remaining clients are abandoned. The listener and transport
+// are closed afterwards along with the HTTP server, and any pending Sentry events are flushed.
+func shutdown(l *quic.Listener, tr *quic.Transport, httpServer *http.Server) {
+	shuttingDown.Store(true)
+	listening.Store(false)
+	if err := l.Close(); err != nil {
+		logger.Error().Err(err).Msg("failed to close listener")
+	}
+
+	for _, c := range clients.Clients() {
+		go func() {
+			c.Drain()
+			_ = c.Disconnect(cloudpacket.DisconnectReasonServerShutdown, "server shutting down")
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		clients.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.Load().Listener.ShutdownTimeout):
+		logger.Error().Int("clients", clients.Len()).Msg("timed out waiting for clients to disconnect")
+		fmt.Printf("Timed out waiting for %d clients to disconnect\n", clients.Len())
+	}
+
+	janitor.Close()
+	// Abandoned clients may still be recording, but their sessions are no longer updated once the catalogue is
+	// closed.
+	if err := sessions.Close(); err != nil {
+		fmt.Printf("Failed to close session catalogue: %v\n", err)
+	}
+	// The transport closes all remaining connections, but not the UDP connection it was created with.
+	if err := tr.Close(); err != nil {
+		logger.Error().Err(err).Msg("failed to close transport")
+	}
+	_ = tr.Conn.Close()
+	stopHTTP(httpServer, time.Second*5)
+	sentry.Flush(time.Second * 5)
 }
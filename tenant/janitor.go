@@ -0,0 +1,98 @@
+package tenant
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/oomph-ac/ocloud/catalogue"
+	"github.com/oomph-ac/ocloud/client/registry"
+	"github.com/rs/zerolog"
+)
+
+// Janitor periodically deletes recordings that have outlived the retention policy of their tenant, removing them
+// from the catalogue and the storage used by the tenant.
+type Janitor struct {
+	cat catalogue.Catalogue
+	m   *Manager
+	// clients is the registry of connected clients. Sessions of connected clients are never deleted.
+	clients *registry.Registry
+	log     zerolog.Logger
+
+	close chan struct{}
+}
+
+// NewJanitor returns a Janitor deleting the recordings in the catalogue passed according to the policies of the
+// Manager, skipping the sessions of clients in the registry passed. The storage used by every tenant is
+// initialized from the sizes of the recordings in the catalogue.
+func NewJanitor(cat catalogue.Catalogue, m *Manager, clients *registry.Registry, log zerolog.Logger) (*Janitor, error) {
+	sessions, err := cat.Find(catalogue.Query{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		_ = m.AddBytes(s.Tenant, s.Size)
+	}
+	return &Janitor{cat: cat, m: m, clients: clients, log: log, close: make(chan struct{})}, nil
+}
+
+// Run runs the janitor at the interval passed, until Close is called.
+func (j *Janitor) Run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		j.Clean(time.Now())
+		select {
+		case <-j.close:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Clean deletes all recordings that should no longer be retained at the time passed. Sessions that are still
+// being recorded are skipped, however long the client has been idle. Sessions that were not finalized because
+// the server stopped unexpectedly are expired relative to the time their recording was last written to.
+func (j *Janitor) Clean(now time.Time) {
+	sessions, err := j.cat.Find(catalogue.Query{})
+	if err != nil {
+		j.log.Error().Err(err).Msg("janitor failed to list sessions")
+		return
+	}
+
+	for _, s := range sessions {
+		if _, ok := j.clients.Client(s.ID); ok {
+			continue
+		}
+		retention := j.m.Policy(s.Tenant).RetentionFor(s.Flags > 0)
+		if retention == 0 {
+			continue
+		}
+		end := s.EndTime
+		if end.IsZero() {
+			end = s.StartTime
+			if info, err := os.Stat(s.Path); err == nil {
+				end = info.ModTime()
+			}
+		}
+		if now.Sub(end) < retention {
+			continue
+		}
+
+		if err := os.Remove(s.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			j.log.Error().Err(err).Str("session", s.ID.String()).Msg("janitor failed to delete recording")
+			continue
+		}
+		if err := j.cat.Delete(s.ID); err != nil {
+			j.log.Error().Err(err).Str("session", s.ID.String()).Msg("janitor failed to remove session from catalogue")
+			continue
+		}
+		_ = j.m.AddBytes(s.Tenant, -s.Size)
+	}
+}
+
+// Close stops the janitor.
+func (j *Janitor) Close() {
+	close(j.close)
+}
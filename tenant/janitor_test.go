@@ -0,0 +1,83 @@
+package tenant_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oomph-ac/ocloud/catalogue"
+	"github.com/oomph-ac/ocloud/client"
+	"github.com/oomph-ac/ocloud/client/registry"
+	"github.com/oomph-ac/ocloud/internal/pipe"
+	"github.com/oomph-ac/ocloud/tenant"
+	"github.com/rs/zerolog"
+)
+
+// recording adds an unfinalized session with the ID passed to the catalogue, whose recording was last written to
+// at the time passed.
+func recording(t *testing.T, cat catalogue.Catalogue, id uuid.UUID, modTime time.Time) catalogue.Session {
+	t.Helper()
+	s := catalogue.Session{ID: id, Tenant: "a", StartTime: modTime, Size: 100, Path: filepath.Join(t.TempDir(), id.String()+".ocr")}
+	if err := os.WriteFile(s.Path, make([]byte, s.Size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(s.Path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.Put(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJanitorClean(t *testing.T) {
+	cat, err := catalogue.OpenFile(filepath.Join(t.TempDir(), "sessions.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cat.Close()
+
+	stream, proxyConn := pipe.New()
+	defer proxyConn.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, proxyConn)
+	}()
+	c := client.New(stream, stream.RemoteAddr(), zerolog.Nop(), client.DefaultConfig())
+	defer c.Close(nil)
+	clients := registry.New()
+	clients.Add(c)
+
+	now := time.Now()
+	// The client is connected, but has not sent any packets for longer than the retention period.
+	idle := recording(t, cat, c.SessionID(), now.Add(-time.Hour*2))
+	crashed := recording(t, cat, uuid.New(), now.Add(-time.Hour*2))
+	recent := recording(t, cat, uuid.New(), now.Add(-time.Minute))
+
+	m := tenant.NewManager(tenant.Policies{Default: tenant.Policy{Retention: tenant.Duration(time.Hour)}})
+	j, err := tenant.NewJanitor(cat, m, clients, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Clean(now)
+
+	for _, s := range []catalogue.Session{idle, recent} {
+		if _, ok := cat.Session(s.ID); !ok {
+			t.Errorf("expected session %v to be kept", s.ID)
+		}
+		if _, err := os.Stat(s.Path); err != nil {
+			t.Errorf("expected recording of session %v to be kept, got %v", s.ID, err)
+		}
+	}
+	if _, ok := cat.Session(crashed.ID); ok {
+		t.Error("expected expired session to be removed from the catalogue")
+	}
+	if _, err := os.Stat(crashed.Path); !os.IsNotExist(err) {
+		t.Errorf("expected recording of expired session to be deleted, got %v", err)
+	}
+	if used := m.Bytes("a"); used != 200 {
+		t.Errorf("expected 200 bytes used by the tenant after cleaning, got %d", used)
+	}
+}
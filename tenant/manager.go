@@ -0,0 +1,97 @@
+package tenant
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Manager enforces the policies of all tenants, keeping track of the streams open and the storage used by each
+// tenant.
+type Manager struct {
+	policies atomic.Pointer[Policies]
+
+	streams map[string]int
+	bytes   map[string]int64
+	mu      sync.Mutex
+}
+
+// NewManager returns a Manager enforcing the policies passed.
+func NewManager(policies Policies) *Manager {
+	m := &Manager{
+		streams: make(map[string]int),
+		bytes:   make(map[string]int64),
+	}
+	m.SetPolicies(policies)
+	return m
+}
+
+// SetPolicies replaces the policies enforced by the Manager. The new policies apply to checks made afterwards.
+func (m *Manager) SetPolicies(policies Policies) {
+	m.policies.Store(&policies)
+}
+
+// Policy returns the policy of the tenant passed.
+func (m *Manager) Policy(tenant string) Policy {
+	return m.policies.Load().For(tenant)
+}
+
+// OpenStream registers a new stream for the tenant passed. An error is returned if the tenant already has the
+// maximum amount of streams open, or if its storage quota is exhausted. The function returned must be called
+// once the stream is closed.
+func (m *Manager) OpenStream(tenant string) (closeStream func(), err error) {
+	policy := m.Policy(tenant)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if policy.MaxConcurrentStreams > 0 && m.streams[tenant] >= policy.MaxConcurrentStreams {
+		return nil, fmt.Errorf("tenant %s has reached its limit of %d concurrent streams", tenant, policy.MaxConcurrentStreams)
+	}
+	if policy.MaxBytes > 0 && m.bytes[tenant] >= policy.MaxBytes {
+		return nil, fmt.Errorf("tenant %s has exhausted its storage quota of %d bytes", tenant, policy.MaxBytes)
+	}
+	m.streams[tenant]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if m.streams[tenant]--; m.streams[tenant] <= 0 {
+				delete(m.streams, tenant)
+			}
+		})
+	}, nil
+}
+
+// Streams returns the amount of streams currently open for the tenant passed.
+func (m *Manager) Streams(tenant string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.streams[tenant]
+}
+
+// AddBytes adds n bytes to the storage used by the tenant passed. n may be negative when recordings are deleted.
+// An error is returned if the tenant exceeds its storage quota.
+func (m *Manager) AddBytes(tenant string, n int64) error {
+	policy := m.Policy(tenant)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytes[tenant] = max(m.bytes[tenant]+n, 0)
+	if policy.MaxBytes > 0 && m.bytes[tenant] > policy.MaxBytes {
+		return fmt.Errorf("tenant %s exceeded its storage quota of %d bytes", tenant, policy.MaxBytes)
+	}
+	return nil
+}
+
+// Bytes returns the storage used by the tenant passed.
+func (m *Manager) Bytes(tenant string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.bytes[tenant]
+}
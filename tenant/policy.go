@@ -0,0 +1,90 @@
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded in JSON as a string, such as "720h".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Policy holds the limits and retention rules applied to the sessions of a tenant. Zero values mean that no limit
+// applies.
+type Policy struct {
+	// MaxBytes is the maximum total size of all recordings stored for the tenant.
+	MaxBytes int64 `json:"max_bytes"`
+	// MaxSessionLength is the maximum duration of a single session.
+	MaxSessionLength Duration `json:"max_session_length"`
+	// MaxConcurrentStreams is the maximum amount of streams the proxies of the tenant may have open at once.
+	MaxConcurrentStreams int `json:"max_concurrent_streams"`
+	// Retention is the duration that recordings are kept for after the session ended.
+	Retention Duration `json:"retention"`
+	// FlaggedRetention is the duration that recordings with at least one flag are kept for after the session
+	// ended. If shorter than Retention, Retention is used instead.
+	FlaggedRetention Duration `json:"flagged_retention"`
+}
+
+// RetentionFor returns the duration a recording should be kept for, depending on whether it holds any flags. Zero
+// is returned if recordings should be kept forever.
+func (p Policy) RetentionFor(flagged bool) time.Duration {
+	if p.Retention == 0 || (flagged && p.FlaggedRetention == 0) {
+		return 0
+	}
+	if flagged {
+		return max(time.Duration(p.Retention), time.Duration(p.FlaggedRetention))
+	}
+	return time.Duration(p.Retention)
+}
+
+// Policies holds the policies of all tenants.
+type Policies struct {
+	// Default is the policy used for tenants without a policy of their own.
+	Default Policy `json:"default"`
+	// Tenants holds the policies of specific tenants, by tenant ID.
+	Tenants map[string]Policy `json:"tenants"`
+}
+
+// For returns the policy of the tenant passed.
+func (p Policies) For(tenant string) Policy {
+	if policy, ok := p.Tenants[tenant]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// LoadPolicies loads the policies from the JSON file at the path passed.
+func LoadPolicies(path string) (Policies, error) {
+	var p Policies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("failed to read tenant policies: %v", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("failed to parse tenant policies: %v", err)
+	}
+	for id := range p.Tenants {
+		if err := Validate(id); err != nil {
+			return p, fmt.Errorf("invalid tenant policies: %v", err)
+		}
+	}
+	return p, nil
+}
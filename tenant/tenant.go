@@ -0,0 +1,22 @@
+// Package tenant implements the isolation of the networks, or tenants, that share an oCloud server.
+package tenant
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// validID matches the IDs of tenants that are accepted. IDs are used as directory names, so they are limited to a
+// safe set of characters.
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// Validate returns an error if the tenant ID passed is empty or may not be used as a tenant ID.
+func Validate(id string) error {
+	if id == "" {
+		return fmt.Errorf("no tenant specified")
+	}
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid tenant ID %q", id)
+	}
+	return nil
+}